@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+)
+
+// phase is the stage of the game as seen by the client.
+type phase int
+
+const (
+	phaseConnecting phase = iota
+	phaseWaiting          // Connected, waiting for an opponent
+	phasePlaying
+	phaseOver
+	phaseDisconnected
+)
+
+// gameState is the client's view of the game. It only changes through
+// apply, driven by the typed events sent by the server, and is owned by the
+// goroutine running the interface.
+type gameState struct {
+	phase     phase
+	gameID    string
+	spectator bool // Watching without a seat; nickname and opponent are then the two players
+	nickname  string
+	symbol    string
+	opponent  string
+	myTurn    bool
+	turn      string     // Nickname of the player to move
+	board     [][]string // nil until the server sends the first board
+	result    string     // Description of the result once the game is over
+
+	series         *connect4.Series // Score of the rematches, nil before the first game starts
+	rematchOffered bool             // The opponent asked for a rematch
+}
+
+// apply updates the state with an update received from the server.
+func (g *gameState) apply(update *connect4.GameUpdate) {
+	if update.Board != "" {
+		g.board = parseBoard(update.Board)
+	}
+
+	switch event := update.Event.(type) {
+	case *connect4.GameUpdate_Welcome:
+		g.gameID = event.Welcome.GameId
+		g.spectator = event.Welcome.Spectator
+		g.symbol = event.Welcome.Symbol
+		g.phase = phaseWaiting
+		if !g.spectator {
+			g.nickname = event.Welcome.Nickname
+		}
+
+	case *connect4.GameUpdate_GameStarted:
+		for _, player := range event.GameStarted.Players {
+			switch {
+			case g.spectator && player.Symbol == "x":
+				g.nickname = player.Nickname
+			case player.Symbol != g.symbol:
+				g.opponent = player.Nickname
+			}
+		}
+		g.phase = phasePlaying
+		g.series = event.GameStarted.Series
+		g.result = ""
+		g.rematchOffered = false
+
+	case *connect4.GameUpdate_TurnChanged:
+		g.myTurn = event.TurnChanged.YourTurn
+		g.turn = event.TurnChanged.Player
+		g.phase = phasePlaying
+
+	case *connect4.GameUpdate_MoveRejected:
+		// The server still waits for a move after an invalid column
+		g.myTurn = event.MoveRejected.Reason == connect4.MoveRejected_INVALID_COLUMN
+
+	case *connect4.GameUpdate_GameOver:
+		g.myTurn = false
+		g.phase = phaseOver
+		g.result = describeResult(event.GameOver, g.spectator)
+		g.series = event.GameOver.Series
+
+	case *connect4.GameUpdate_RematchOffered:
+		g.rematchOffered = true
+	}
+}
+
+// score describes the series of games, e.g. "alice 2 - 1 bob (1 tie)", or
+// returns "" before the first game ends.
+func (g *gameState) score() string {
+	if g.series == nil || g.series.GamesPlayed == 0 || len(g.series.Players) != 2 {
+		return ""
+	}
+
+	first, second := g.series.Players[0], g.series.Players[1]
+	score := fmt.Sprintf("%s %d - %d %s", first.Nickname, first.Wins, second.Wins, second.Nickname)
+	switch g.series.Ties {
+	case 0:
+	case 1:
+		score += " (1 tie)"
+	default:
+		score += fmt.Sprintf(" (%d ties)", g.series.Ties)
+	}
+	return score
+}
+
+// formatChat formats a chat message as a line of the conversation.
+func formatChat(message *connect4.ChatMessage) string {
+	line := "<" + message.From + "> " + message.Text
+	if message.Emote != "" {
+		line = "* " + message.From + " " + message.Text
+	}
+
+	if message.Channel == connect4.ChatMessage_SPECTATORS {
+		return "[spectators] " + line
+	}
+	return line
+}
+
+// formatLatency rounds the round trip of a ping for display, e.g. "23ms".
+func formatLatency(latency time.Duration) string {
+	if latency < time.Millisecond {
+		return "<1ms"
+	}
+	return latency.Round(time.Millisecond).String()
+}
+
+// disconnect marks the game as lost because the stream was closed.
+func (g *gameState) disconnect() {
+	g.myTurn = false
+	g.phase = phaseDisconnected
+}
+
+func describeResult(over *connect4.GameOver, spectator bool) string {
+	switch {
+	case over.Reason == connect4.GameOver_ABORTED:
+		return "The game was aborted by an operator."
+	case over.Winner == "":
+		return "The game is a tie."
+	case spectator:
+		return over.Winner + " won the game."
+	case over.YouWon && over.Reason == connect4.GameOver_ABANDONED:
+		return "You won, your opponent left the game."
+	case over.YouWon && over.Reason == connect4.GameOver_RESIGNATION:
+		return "You won, your opponent resigned."
+	case over.YouWon:
+		return "You won!"
+	case over.Reason == connect4.GameOver_RESIGNATION:
+		return "You resigned. " + over.Winner + " wins."
+	default:
+		return over.Winner + " won the game."
+	}
+}
+
+// inputKind tells what a line typed by the player asks for.
+type inputKind int
+
+const (
+	inputNone inputKind = iota
+	inputMove
+	inputResign
+	inputRematch
+	inputQuit
+	inputChat
+	inputEmote
+	inputPing
+	inputUnknown
+)
+
+// input is a line typed by the player.
+type input struct {
+	kind   inputKind
+	column int    // Zero-based column of a move
+	text   string // Chat message, or name of the emote
+}
+
+// parseInput reads a line typed by the player: a column number, /resign,
+// /rematch, /quit, /ping, /emote followed by the name of an emote, or any other text, which
+// is sent to the chat.
+func parseInput(line string) input {
+	line = strings.TrimSpace(line)
+
+	switch {
+	case line == "":
+		return input{kind: inputNone}
+	case line == "/resign":
+		return input{kind: inputResign}
+	case line == "/rematch":
+		return input{kind: inputRematch}
+	case line == "/quit":
+		return input{kind: inputQuit}
+	case line == "/ping":
+		return input{kind: inputPing}
+	case strings.HasPrefix(line, "/emote "):
+		return input{kind: inputEmote, text: strings.TrimSpace(strings.TrimPrefix(line, "/emote "))}
+	case strings.HasPrefix(line, "/"):
+		return input{kind: inputUnknown}
+	}
+
+	column, err := strconv.Atoi(line)
+	if err != nil {
+		return input{kind: inputChat, text: line}
+	}
+	if column < 1 || column > COLS {
+		return input{kind: inputUnknown}
+	}
+	return input{kind: inputMove, column: column - 1}
+}
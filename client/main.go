@@ -2,10 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"log"
-	"strconv"
+	"strings"
 
-	"google.golang.org/grpc"
+	"golang.org/x/term"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 
 	"bufio"
 	"fmt"
@@ -13,82 +20,306 @@ import (
 	"time"
 
 	connect4 "github.com/danieljcksn/connect-four/proto"
+	"github.com/danieljcksn/connect-four/sdk"
 )
 
 const COLS = 7
 
 func main() {
+	flags, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+
+	saved, err := loadProfile(flags.profilePath)
+	if err != nil {
+		log.Fatalf("failed to load profile: %v", err)
+	}
+
+	profile := saved
+	flags.apply(&profile)
+	if err := profile.Validate(); err != nil {
+		log.Fatalf("invalid settings: %v", err)
+	}
+
+	if flags.save || flags.logout {
+		if flags.save {
+			saved = profile
+		}
+		saved.SessionToken, saved.TokenExpiresAt = profile.SessionToken, profile.TokenExpiresAt
+		if err := saved.Save(flags.profilePath); err != nil {
+			log.Fatalf("failed to save profile: %v", err)
+		}
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
 
-	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure(), grpc.WithBlock())
+	opts := []sdk.Option{sdk.WithReconnect(5, time.Second), sdk.WithHeartbeat(profile.HeartbeatInterval, profile.HeartbeatTimeout)}
+	if profile.UseTLS() {
+		tlsConfig, err := clientTLSConfig(profile.TLS.CACert, profile.TLS.Cert, profile.TLS.Key, profile.TLS.ServerName)
+		if err != nil {
+			log.Fatalf("failed to configure TLS: %v", err)
+		}
+		opts = append(opts, sdk.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
 
+	nickname := profile.Nickname
+	if nickname == "" {
+		fmt.Print("Enter your nickname: ")
+		scanner.Scan()
+		nickname = scanner.Text()
+	}
+
+	if profile.HasSession(nickname) {
+		opts = append(opts, sdk.WithToken(profile.SessionToken))
+	}
+
+	ctx := context.Background()
+	client, err := sdk.Connect(ctx, profile.ServerAddr, opts...)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 
-	defer conn.Close()
-	client := connect4.NewConnect4GameClient(conn)
+	defer client.Close()
 
-	stream, err := client.GameSession(context.Background())
-	if err != nil {
-		log.Fatalf("error creating game session: %v", err)
+	if client.Token() != "" {
+		fmt.Println("Logged in as", nickname, "with the saved session.")
+	} else {
+		fmt.Print("Enter your password (leave it blank to play as a guest): ")
+		password := readPassword(scanner)
+
+		if password != "" {
+			res, err := login(ctx, client, scanner, nickname, password)
+			if err != nil {
+				log.Fatalf("failed to log in: %v", err)
+			}
+
+			// Remember the session so the next run logs in automatically
+			saved.Nickname = nickname
+			saved.SessionToken = res.Token
+			saved.TokenExpiresAt = time.Unix(res.ExpiresAt, 0)
+			if err := saved.Save(flags.profilePath); err != nil {
+				log.Printf("failed to save the session to the profile: %v", err)
+			}
+		}
 	}
 
-	fmt.Print("Enter your nickname: ")
-	scanner.Scan()
+	var game *sdk.Game
+	switch {
+	case flags.create:
+		game, err = client.CreateGame(ctx, nickname, flags.options)
+	case flags.spectate != "":
+		game, err = client.SpectateGame(ctx, flags.spectate, nickname)
+	default:
+		game, err = client.JoinGame(ctx, flags.join, nickname)
+	}
 
-	nickname := scanner.Text()
+	if err == nil {
+		defer game.Close()
 
-	if err := stream.Send(&connect4.GameCommand{Command: "connect", Nickname: nickname}); err != nil {
-		log.Fatalf("failed to send connection request: %v", err)
+		if flags.plain || !term.IsTerminal(int(os.Stdout.Fd())) {
+			err = runPlain(game, scanner, themes[profile.Theme])
+		} else {
+			err = runTUI(game, nickname, themes[profile.Theme])
+		}
 	}
 
-	isMyTurn := false
+	if status.Code(err) == codes.Unauthenticated && client.Token() != "" {
+		err = fmt.Errorf("the server rejected the saved session (%s), run the client with -logout to log in again", status.Convert(err).Message())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		client.Close()
+		os.Exit(1)
+	}
+}
+
+// runPlain plays the game printing the messages of the server line by line.
+// Server updates and lines typed by the player are handled by a single loop,
+// so the player can resign or quit at any time. It returns the error that
+// ended the game session, if any.
+func runPlain(game *sdk.Game, scanner *bufio.Scanner, t theme) error {
 
+	lines := make(chan string)
 	go func() {
-		for {
-			in, err := stream.Recv()
-			if err != nil {
-				log.Fatalf("Failed to receive a message: %v", err)
+		defer close(lines)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	fmt.Println("Type a column number (1 to 7) to play, /resign to give up or /quit to leave; /ping shows the latency.")
+	fmt.Println("Anything else you type is sent to the chat; /emote gg sends an emote.")
+	fmt.Println()
+
+	state := &gameState{}
+	for {
+		select {
+		case event, ok := <-game.Events():
+			if !ok {
+				state.disconnect()
+				if err := game.Err(); err != nil {
+					return err
+				}
+				fmt.Println("The server closed the game session.")
+				return nil
 			}
-			fmt.Println(in.Message)
-			if in.Board != "" { // Check if the board data is included in the update
-				fmt.Println("Current Board:")
-				fmt.Println(in.Board) // Print the formatted board received from the server
+
+			switch event := event.(type) {
+			case sdk.Reconnecting:
+				state.disconnect()
+				fmt.Printf("Connection lost (%v). Reconnecting, attempt %d...\n", status.Convert(event.Err).Message(), event.Attempt)
+				continue
+			case sdk.Reconnected:
+				fmt.Println("Reconnected.")
+				continue
+			case sdk.Latency:
+				continue // Shown on /ping
+			}
+
+			update := event.(sdk.Update)
+			state.apply(update.GameUpdate)
+
+			switch event := update.Event.(type) {
+			case *connect4.GameUpdate_Chat:
+				fmt.Println(formatChat(event.Chat))
+				continue
+			case *connect4.GameUpdate_ChatHistory:
+				for _, message := range event.ChatHistory.Messages {
+					fmt.Println(formatChat(message))
+				}
+				continue
 			}
 
-			// Check if it's this client's turn
-			if in.Message == "It's your turn!" || in.Message == "Invalid move. Try again." {
-				isMyTurn = true
-			} else {
-				isMyTurn = false
+			fmt.Println(update.Message)
+			if update.Board != "" { // Check if the board data is included in the update
+				fmt.Println("Current Board:")
+				fmt.Println(colorizeBoard(update.Board, t)) // Print the formatted board received from the server
 			}
 
+			switch {
+			case state.myTurn:
+				fmt.Println("Enter column number (1 to 7):")
+			case state.phase == phaseOver && !state.spectator:
+				if score := state.score(); score != "" {
+					fmt.Println("Series:", score)
+				}
+				fmt.Println(state.result, "Type /rematch to play again or /quit to leave.")
+			case state.phase == phaseOver:
+				fmt.Println(state.result)
+			}
 			fmt.Println()
-		}
-	}()
 
-	for {
-		for !isMyTurn {
-			// Wait for the turn flag to change
-			<-time.After(time.Millisecond) // Add a small delay to avoid spinning and using 100% CPU
+		case line, ok := <-lines:
+			if !ok {
+				return nil // Standard input was closed
+			}
+
+			in := parseInput(line)
+			switch in.kind {
+			case inputQuit:
+				return nil
+			case inputPing:
+				if latency := game.Latency(); latency > 0 {
+					fmt.Println("Latency:", formatLatency(latency))
+				} else {
+					fmt.Println("The latency hasn't been measured yet.")
+				}
+			case inputResign:
+				if err := game.Resign(); err != nil {
+					return err
+				}
+			case inputRematch:
+				if err := game.Rematch(); err != nil {
+					return err
+				}
+			case inputMove:
+				if !state.myTurn {
+					fmt.Println("It's not your turn yet.")
+					continue
+				}
+				if err := game.Move(in.column); err != nil {
+					return err
+				}
+				state.myTurn = false // Wait for the server to accept the move
+			case inputChat:
+				if err := game.Chat(in.text); err != nil {
+					return err
+				}
+			case inputEmote:
+				if err := game.Emote(in.text); err != nil {
+					return err
+				}
+			case inputUnknown:
+				fmt.Println("Invalid input. Please enter a column between 1 and 7, /resign, /rematch, /emote or /quit.")
+			}
 		}
+	}
+}
+
+// login authenticates the player, offering to register the nickname when it
+// doesn't belong to an account yet.
+func login(ctx context.Context, client *sdk.Client, scanner *bufio.Scanner, nickname, password string) (*connect4.LoginResponse, error) {
+	res, err := client.Login(ctx, nickname, password)
+	if err == nil {
+		return res, nil
+	}
 
-		fmt.Println("Enter column number (1 to 7):")
+	fmt.Printf("Could not log in as %s. Register this nickname with the password you typed? (y/n): ", nickname)
+	scanner.Scan()
+	if !strings.EqualFold(strings.TrimSpace(scanner.Text()), "y") {
+		return nil, err
+	}
+
+	if err := client.Register(ctx, nickname, password); err != nil {
+		return nil, err
+	}
+
+	return client.Login(ctx, nickname, password)
+}
 
+// readPassword reads a line without echoing it when stdin is a terminal.
+func readPassword(scanner *bufio.Scanner) string {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
 		scanner.Scan()
-		column, err := strconv.Atoi(scanner.Text())
+		return scanner.Text()
+	}
 
-		if err != nil || column < 1 || column > COLS {
-			fmt.Println("Invalid column. Please enter a number between 1 and 7.")
-			continue
-		}
+	password, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return ""
+	}
+	return string(password)
+}
 
-		if err := stream.Send(&connect4.GameCommand{Command: "move", Column: int32(column - 1)}); err != nil {
-			log.Fatalf("failed to send move: %v", err)
+// clientTLSConfig builds the TLS configuration used to dial the server,
+// trusting caFile instead of the system roots when it is set.
+func clientTLSConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
 		}
+	}
 
-		isMyTurn = false // Reset the turn flag after making a move
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
 	}
 
+	return config, nil
 }
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile holds the client settings saved between runs. Command-line flags
+// override the values of the profile for a single run unless -save-profile
+// is given.
+type Profile struct {
+	ServerAddr string `yaml:"server_addr"`
+	Nickname   string `yaml:"nickname,omitempty"`
+	Theme      string `yaml:"theme"`
+
+	TLS ProfileTLS `yaml:"tls"`
+
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"` // Between the pings sent to the server, 0 to never ping
+	HeartbeatTimeout  time.Duration `yaml:"heartbeat_timeout"`  // Silence after which the connection is considered lost
+
+	// Session of the last login, reused to log in automatically
+	SessionToken   string    `yaml:"session_token,omitempty"`
+	TokenExpiresAt time.Time `yaml:"token_expires_at,omitempty"`
+}
+
+type ProfileTLS struct {
+	Enabled    bool   `yaml:"enabled"`
+	CACert     string `yaml:"ca_cert,omitempty"`
+	Cert       string `yaml:"cert,omitempty"`
+	Key        string `yaml:"key,omitempty"`
+	ServerName string `yaml:"server_name,omitempty"`
+}
+
+func defaultProfile() Profile {
+	return Profile{ServerAddr: "localhost:50051", Theme: "classic", HeartbeatInterval: 15 * time.Second, HeartbeatTimeout: 45 * time.Second}
+}
+
+// defaultProfilePath returns ~/.config/connect-four/profile.yaml, or the
+// equivalent configuration directory of the operating system.
+func defaultProfilePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "connect-four-profile.yaml"
+	}
+	return filepath.Join(dir, "connect-four", "profile.yaml")
+}
+
+// loadProfile reads the profile at path, returning the defaults when the
+// file doesn't exist yet.
+func loadProfile(path string) (Profile, error) {
+	profile := defaultProfile()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return profile, nil
+	}
+	if err != nil {
+		return profile, fmt.Errorf("reading profile: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return profile, fmt.Errorf("parsing profile %s: %w", path, err)
+	}
+	return profile, nil
+}
+
+// Save writes the profile to path. It is only readable by the user, since
+// it may hold a session token.
+func (p Profile) Save(path string) error {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// Validate checks the settings that would otherwise only fail after
+// connecting.
+func (p Profile) Validate() error {
+	if p.ServerAddr == "" {
+		return errors.New("server address must not be empty")
+	}
+	if _, ok := themes[p.Theme]; !ok {
+		return fmt.Errorf("unknown theme %q", p.Theme)
+	}
+	if (p.TLS.Cert == "") != (p.TLS.Key == "") {
+		return errors.New("client certificate and key must be set together")
+	}
+	if p.HeartbeatInterval < 0 || p.HeartbeatInterval > 0 && p.HeartbeatTimeout <= p.HeartbeatInterval {
+		return errors.New("heartbeat timeout must be longer than the heartbeat interval")
+	}
+	return nil
+}
+
+// UseTLS reports whether the connection must be encrypted.
+func (p Profile) UseTLS() bool {
+	return p.TLS.Enabled || p.TLS.CACert != "" || p.TLS.Cert != ""
+}
+
+// HasSession reports whether the saved session token of nickname can still
+// be used.
+func (p Profile) HasSession(nickname string) bool {
+	return p.SessionToken != "" && p.Nickname == nickname && time.Now().Before(p.TokenExpiresAt)
+}
+
+// clientFlags holds the command-line flags of the client.
+type clientFlags struct {
+	profilePath string
+	save        bool
+	logout      bool
+	plain       bool
+	create      bool
+	join        string // ID of the game to join
+	spectate    string // ID of the game to watch
+
+	options   *connect4.GameOptions // Options of the game opened by -create
+	firstMove string
+
+	fs      *flag.FlagSet
+	profile Profile // Values of the flags, applied only when set
+}
+
+func parseFlags(args []string) (*clientFlags, error) {
+	f := &clientFlags{fs: flag.NewFlagSet("client", flag.ContinueOnError)}
+
+	f.fs.StringVar(&f.profilePath, "profile", defaultProfilePath(), "profile file with the saved settings")
+	f.fs.BoolVar(&f.save, "save-profile", false, "save the settings given as flags to the profile")
+	f.fs.BoolVar(&f.logout, "logout", false, "forget the saved session token")
+	f.fs.BoolVar(&f.plain, "plain", false, "print the game line by line instead of using the full-screen interface")
+	f.fs.BoolVar(&f.create, "create", false, "open a new game and wait there for an opponent")
+	f.fs.StringVar(&f.join, "join", "", "ID of the game to join (default: any game waiting for an opponent)")
+	f.fs.StringVar(&f.spectate, "spectate", "", "ID of a game to watch without playing")
+
+	f.options = &connect4.GameOptions{}
+	f.fs.StringVar(&f.firstMove, "first-move", "random", "who moves first in a game opened with -create: random (drawn for the first game), creator or redraw (drawn for every game); rematches swap the first player, except with redraw")
+	f.fs.BoolVar(&f.options.CreatorMovesFirst, "move-first", false, "with -first-move creator, make the first move yourself")
+	f.fs.StringVar(&f.options.CreatorSymbol, "symbol", "x", "your symbol in a game opened with -create: x or o")
+
+	f.fs.StringVar(&f.profile.ServerAddr, "server", "", "address of the server (default localhost:50051)")
+	f.fs.StringVar(&f.profile.Nickname, "nickname", "", "nickname to play with, skipping the prompt")
+	f.fs.StringVar(&f.profile.Theme, "theme", "", "color theme of the board: classic, ocean or mono")
+	f.fs.BoolVar(&f.profile.TLS.Enabled, "tls", false, "connect to the server over TLS")
+	f.fs.StringVar(&f.profile.TLS.CACert, "ca-cert", "", "PEM CA used to verify the server certificate (defaults to the system roots)")
+	f.fs.StringVar(&f.profile.TLS.Cert, "cert", "", "PEM client certificate for servers that require mutual TLS")
+	f.fs.StringVar(&f.profile.TLS.Key, "key", "", "PEM private key of the client certificate")
+	f.fs.StringVar(&f.profile.TLS.ServerName, "server-name", "", "overrides the host name checked against the server certificate")
+	// Unlike the settings above, 0 is a valid interval, so the defaults are
+	// the real ones instead of the zero value
+	defaults := defaultProfile()
+	f.fs.DurationVar(&f.profile.HeartbeatInterval, "heartbeat-interval", defaults.HeartbeatInterval, "interval between the pings sent to the server, 0 to never ping")
+	f.fs.DurationVar(&f.profile.HeartbeatTimeout, "heartbeat-timeout", defaults.HeartbeatTimeout, "how long the server can stay silent before the connection is considered lost")
+
+	if err := f.fs.Parse(args); err != nil {
+		return f, err
+	}
+	if f.create && f.join != "" || f.spectate != "" && (f.create || f.join != "") {
+		return f, errors.New("only one of -create, -join and -spectate can be used")
+	}
+
+	var err error
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "first-move", "move-first", "symbol":
+			if !f.create {
+				err = fmt.Errorf("-%s only applies to games opened with -create", fl.Name)
+			}
+		}
+	})
+	if err != nil {
+		return f, err
+	}
+
+	firstMove, ok := connect4.GameOptions_FirstMove_value[strings.ToUpper(f.firstMove)]
+	if !ok {
+		return f, fmt.Errorf("invalid -first-move %q: must be random, creator or redraw", f.firstMove)
+	}
+	f.options.FirstMove = connect4.GameOptions_FirstMove(firstMove)
+	if f.options.CreatorSymbol != "x" && f.options.CreatorSymbol != "o" {
+		return f, fmt.Errorf("invalid -symbol %q: must be x or o", f.options.CreatorSymbol)
+	}
+	return f, nil
+}
+
+// apply overrides the profile with the flags given in the command line.
+func (f *clientFlags) apply(profile *Profile) {
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "server":
+			profile.ServerAddr = f.profile.ServerAddr
+		case "nickname":
+			profile.Nickname = f.profile.Nickname
+		case "theme":
+			profile.Theme = f.profile.Theme
+		case "tls":
+			profile.TLS.Enabled = f.profile.TLS.Enabled
+		case "ca-cert":
+			profile.TLS.CACert = f.profile.TLS.CACert
+		case "cert":
+			profile.TLS.Cert = f.profile.TLS.Cert
+		case "key":
+			profile.TLS.Key = f.profile.TLS.Key
+		case "server-name":
+			profile.TLS.ServerName = f.profile.TLS.ServerName
+		case "heartbeat-interval":
+			profile.HeartbeatInterval = f.profile.HeartbeatInterval
+		case "heartbeat-timeout":
+			profile.HeartbeatTimeout = f.profile.HeartbeatTimeout
+		}
+	})
+
+	if f.logout {
+		profile.SessionToken = ""
+		profile.TokenExpiresAt = time.Time{}
+	}
+}
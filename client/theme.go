@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// theme defines how the discs of each symbol are colored.
+type theme struct {
+	ansi  map[string]string      // Escape codes used by the line mode
+	discs map[string]tcell.Color // Colors used by the full-screen mode
+	board tcell.Color            // Background of the board in the full-screen mode
+}
+
+const ansiReset = "\033[0m"
+
+var themes = map[string]theme{
+	// Red and yellow discs on a blue board
+	"classic": {
+		ansi:  map[string]string{"x": "\033[1;31m", "o": "\033[1;33m"},
+		discs: map[string]tcell.Color{"x": tcell.ColorRed, "o": tcell.ColorYellow},
+		board: tcell.ColorNavy,
+	},
+	// Blue and cyan discs on a dark board
+	"ocean": {
+		ansi:  map[string]string{"x": "\033[1;34m", "o": "\033[1;36m"},
+		discs: map[string]tcell.Color{"x": tcell.ColorDodgerBlue, "o": tcell.ColorAqua},
+		board: tcell.ColorBlack,
+	},
+	// No colors, for terminals without color support
+	"mono": {board: tcell.ColorDefault},
+}
+
+// colorizeBoard colors the discs of a board formatted as "[x][o][ ]" rows.
+func colorizeBoard(board string, t theme) string {
+	if len(t.ansi) == 0 {
+		return board
+	}
+
+	var colored strings.Builder
+	for _, cell := range strings.SplitAfter(board, "]") {
+		symbol := strings.TrimSuffix(strings.TrimPrefix(strings.TrimLeft(cell, "\n"), "["), "]")
+		if color, ok := t.ansi[symbol]; ok {
+			cell = strings.Replace(cell, symbol, color+symbol+ansiReset, 1)
+		}
+		colored.WriteString(cell)
+	}
+	return colored.String()
+}
+
+// parseBoard splits a board formatted as "[x][o][ ]" rows into its cells.
+func parseBoard(board string) [][]string {
+	var cells [][]string
+	for _, line := range strings.Split(strings.TrimSpace(board), "\n") {
+		line = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+		cells = append(cells, strings.Split(line, "]["))
+	}
+	return cells
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"github.com/danieljcksn/connect-four/sdk"
+	"github.com/gdamore/tcell/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ROWS = 6
+
+	cellWidth      = 4                     // Columns of the terminal used by each cell of the board
+	dropFrame      = 40 * time.Millisecond // Time a falling disc takes to pass each row
+	eventPaneWidth = 36                    // Minimum width of the event pane when beside the board
+)
+
+// updateEvent delivers a message received from the server to the event loop.
+type updateEvent struct {
+	tcell.EventTime
+	update *connect4.GameUpdate
+}
+
+// connectionEvent reports that the connection was lost or recovered.
+type connectionEvent struct {
+	tcell.EventTime
+	event sdk.Event
+}
+
+// streamErrorEvent tells the event loop that the game session ended.
+type streamErrorEvent struct {
+	tcell.EventTime
+	err error // nil when the server closed the session
+}
+
+// dropTickEvent advances the animation of a falling disc.
+type dropTickEvent struct {
+	tcell.EventTime
+}
+
+// drop is a disc falling into its column.
+type drop struct {
+	row, col, target int
+	symbol           string
+}
+
+// tui is the full-screen interface of the client. All of its state is only
+// touched by the event loop in run; the stream and the animation timers
+// communicate with it by posting events to the screen.
+type tui struct {
+	screen tcell.Screen
+	game   *sdk.Game
+	theme  theme
+
+	nickname string
+	state    *gameState
+
+	cursor        int // Column selected for the next move
+	status        string
+	latency       time.Duration // Round trip of the last ping, 0 until measured
+	drop          *drop
+	confirmResign bool   // Set after r is pressed once, resigning on the second press
+	chatting      bool   // Keys are typed into chatInput instead of playing
+	chatInput     []rune // Message being typed
+
+	events []string // Messages shown in the event pane
+	scroll int      // Lines scrolled back in the event pane
+}
+
+// runTUI plays the game on a full-screen interface until the player quits.
+func runTUI(game *sdk.Game, nickname string, t theme) error {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err := screen.Init(); err != nil {
+		return err
+	}
+	defer screen.Fini()
+
+	ui := &tui{
+		screen:   screen,
+		game:     game,
+		theme:    t,
+		nickname: nickname,
+		state:    &gameState{},
+		cursor:   COLS / 2,
+		status:   "Connecting...",
+	}
+	go ui.receive()
+
+	return ui.run()
+}
+
+// receive forwards the events of the game to the event loop.
+func (ui *tui) receive() {
+	for event := range ui.game.Events() {
+		if update, ok := event.(sdk.Update); ok {
+			ui.screen.PostEventWait(&updateEvent{update: update.GameUpdate})
+			continue
+		}
+		ui.screen.PostEventWait(&connectionEvent{event: event})
+	}
+	ui.screen.PostEventWait(&streamErrorEvent{err: ui.game.Err()})
+}
+
+func (ui *tui) run() error {
+	for {
+		ui.draw()
+
+		switch ev := ui.screen.PollEvent().(type) {
+		case nil:
+			return nil // The screen was finalized
+		case *tcell.EventResize:
+			ui.screen.Sync()
+		case *tcell.EventKey:
+			if ui.handleKey(ev) {
+				return nil
+			}
+		case *updateEvent:
+			ui.handleUpdate(ev.update)
+		case *connectionEvent:
+			ui.handleConnection(ev.event)
+		case *streamErrorEvent:
+			ui.state.disconnect()
+			if status.Code(ev.err) == codes.Unauthenticated {
+				return ev.err // Nothing can be done in this session
+			}
+			ui.status = "Disconnected from the server. Press q to quit."
+			if ev.err != nil {
+				ui.addEvent(fmt.Sprintf("Connection closed: %v", ev.err))
+			}
+		case *dropTickEvent:
+			ui.advanceDrop()
+		}
+	}
+}
+
+// handleKey processes a key press and reports whether the player quit.
+func (ui *tui) handleKey(ev *tcell.EventKey) bool {
+	if ui.chatting {
+		ui.handleChatKey(ev)
+		return false
+	}
+
+	if ev.Key() != tcell.KeyRune || ev.Rune() != 'r' {
+		ui.confirmResign = false
+	}
+
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		return true
+	case tcell.KeyLeft:
+		ui.cursor = max(ui.cursor-1, 0)
+	case tcell.KeyRight:
+		ui.cursor = min(ui.cursor+1, COLS-1)
+	case tcell.KeyEnter, tcell.KeyDown:
+		ui.sendMove()
+	case tcell.KeyPgUp:
+		ui.scroll = min(ui.scroll+5, max(len(ui.events)-1, 0))
+	case tcell.KeyPgDn:
+		ui.scroll = max(ui.scroll-5, 0)
+	case tcell.KeyRune:
+		switch r := ev.Rune(); {
+		case r == 'q':
+			return true
+		case r == 'r':
+			ui.resign()
+		case r == 'n':
+			ui.rematch()
+		case r == 't', r == '/':
+			ui.chatting = true
+			if r == '/' {
+				ui.chatInput = []rune{'/'}
+			}
+		case r == ' ':
+			ui.sendMove()
+		case r >= '1' && r < '1'+COLS:
+			ui.cursor = int(r - '1')
+			ui.sendMove()
+		}
+	}
+	return false
+}
+
+// handleChatKey edits the chat message, sending it on Enter.
+func (ui *tui) handleChatKey(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		ui.chatting = false
+		ui.chatInput = nil
+	case tcell.KeyEnter:
+		ui.sendChat()
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(ui.chatInput) > 0 {
+			ui.chatInput = ui.chatInput[:len(ui.chatInput)-1]
+		}
+	case tcell.KeyRune:
+		ui.chatInput = append(ui.chatInput, ev.Rune())
+	}
+}
+
+func (ui *tui) sendChat() {
+	in := parseInput(string(ui.chatInput))
+
+	var err error
+	switch in.kind {
+	case inputNone:
+	case inputChat:
+		err = ui.game.Chat(in.text)
+	case inputEmote:
+		err = ui.game.Emote(in.text)
+	default:
+		ui.status = "Type a message, or /emote followed by the name of an emote."
+		return // Keep the text so it can be fixed
+	}
+
+	if err != nil {
+		ui.addEvent(fmt.Sprintf("Failed to send the message: %v", err))
+	}
+	ui.chatting = false
+	ui.chatInput = nil
+}
+
+func (ui *tui) sendMove() {
+	if !ui.state.myTurn || ui.drop != nil {
+		return
+	}
+
+	if err := ui.game.Move(ui.cursor); err != nil {
+		ui.addEvent(fmt.Sprintf("Failed to send the move: %v", err))
+		return
+	}
+	ui.state.myTurn = false // Wait for the server to accept the move
+}
+
+// rematch offers or accepts another game once the current one is over.
+func (ui *tui) rematch() {
+	if ui.state.phase != phaseOver || ui.state.spectator {
+		return
+	}
+
+	if err := ui.game.Rematch(); err != nil {
+		ui.addEvent(fmt.Sprintf("Failed to ask for a rematch: %v", err))
+	}
+}
+
+// resign asks for a confirmation and then gives up the game.
+func (ui *tui) resign() {
+	if ui.state.phase != phasePlaying || ui.state.spectator {
+		return
+	}
+
+	if !ui.confirmResign {
+		ui.confirmResign = true
+		return
+	}
+
+	ui.confirmResign = false
+	if err := ui.game.Resign(); err != nil {
+		ui.addEvent(fmt.Sprintf("Failed to resign: %v", err))
+	}
+}
+
+func (ui *tui) handleConnection(event sdk.Event) {
+	switch event := event.(type) {
+	case sdk.Reconnecting:
+		ui.state.disconnect()
+		ui.status = fmt.Sprintf("Connection lost, reconnecting (attempt %d)...", event.Attempt)
+		ui.addEvent(fmt.Sprintf("Connection lost: %s", status.Convert(event.Err).Message()))
+	case sdk.Reconnected:
+		ui.addEvent("Reconnected.")
+	case sdk.Latency:
+		ui.latency = event.RoundTrip
+	}
+}
+
+func (ui *tui) handleUpdate(update *connect4.GameUpdate) {
+	previous := ui.state.board
+	ui.state.apply(update)
+
+	switch event := update.Event.(type) {
+	case *connect4.GameUpdate_Chat:
+		ui.addEvent(formatChat(event.Chat))
+		return
+	case *connect4.GameUpdate_ChatHistory:
+		for _, message := range event.ChatHistory.Messages {
+			ui.addEvent(formatChat(message))
+		}
+		return
+	}
+
+	if update.Message != "" {
+		ui.addEvent(update.Message)
+		ui.status = update.Message
+	}
+	if ui.state.phase == phaseOver {
+		ui.status = ui.state.result
+	}
+
+	if update.Board != "" {
+		ui.startDrop(previous, ui.state.board)
+	}
+}
+
+// startDrop animates the disc added to the board, if any.
+func (ui *tui) startDrop(previous, board [][]string) {
+	if len(previous) != len(board) {
+		return
+	}
+
+	for row := range board {
+		for col := range board[row] {
+			if col < len(previous[row]) && previous[row][col] == " " && board[row][col] != " " {
+				ui.drop = &drop{col: col, target: row, symbol: board[row][col]}
+				ui.scheduleDropTick()
+				return
+			}
+		}
+	}
+}
+
+func (ui *tui) advanceDrop() {
+	if ui.drop == nil {
+		return
+	}
+
+	ui.drop.row++
+	if ui.drop.row >= ui.drop.target {
+		ui.drop = nil
+		return
+	}
+	ui.scheduleDropTick()
+}
+
+func (ui *tui) scheduleDropTick() {
+	time.AfterFunc(dropFrame, func() {
+		ui.screen.PostEvent(&dropTickEvent{})
+	})
+}
+
+func (ui *tui) addEvent(message string) {
+	ui.events = append(ui.events, message)
+	if ui.scroll > 0 {
+		ui.scroll++ // Keep the lines the player scrolled back to in place
+	}
+}
+
+func (ui *tui) draw() {
+	ui.screen.Clear()
+	width, height := ui.screen.Size()
+
+	boardWidth := COLS*cellWidth + 1
+	boardHeight := ROWS + 3 // Cursor line, rows and column numbers
+
+	if width < boardWidth+4 || height < boardHeight+4 {
+		drawText(ui.screen, 0, 0, width, tcell.StyleDefault, "Terminal too small, please resize it.")
+		ui.screen.Show()
+		return
+	}
+
+	ui.drawStatusBar(width)
+
+	boardX, boardY := 2, 2
+	ui.drawBoard(boardX, boardY)
+
+	// The event pane goes beside the board when there is room, or else below it
+	if width-boardX-boardWidth-2 >= eventPaneWidth {
+		ui.drawEvents(boardX+boardWidth+2, boardY, width-boardX-boardWidth-3, height-boardY-2)
+	} else {
+		ui.drawEvents(boardX, boardY+boardHeight+1, width-boardX-1, height-boardY-boardHeight-3)
+	}
+
+	if ui.chatting {
+		prompt := "Say: " + string(ui.chatInput)
+		drawText(ui.screen, 0, height-1, width, tcell.StyleDefault.Bold(true), prompt)
+		ui.screen.ShowCursor(min(len([]rune(prompt)), width-1), height-1)
+	} else {
+		help := "←/→ select  Enter/Space drop  1-7 drop in column  r resign  n rematch  t chat  PgUp/PgDn scroll  q quit"
+		drawText(ui.screen, 0, height-1, width, tcell.StyleDefault.Dim(true), help)
+		ui.screen.HideCursor()
+	}
+
+	ui.screen.Show()
+}
+
+func (ui *tui) drawStatusBar(width int) {
+	style := tcell.StyleDefault.Reverse(true)
+	for x := 0; x < width; x++ {
+		ui.screen.SetContent(x, 0, ' ', nil, style)
+	}
+
+	nickname := ui.nickname
+	if ui.state.nickname != "" {
+		nickname = ui.state.nickname // The server may have replaced it with the account's nickname
+	}
+
+	opponent := ui.state.opponent
+	if opponent == "" {
+		opponent = "waiting..."
+	}
+
+	var state string
+	switch {
+	case ui.confirmResign:
+		state = "Press r again to resign"
+	case ui.state.phase == phasePlaying && ui.state.myTurn:
+		state = "Your turn"
+	case ui.state.phase == phasePlaying && ui.state.turn != "":
+		state = ui.state.turn + "'s turn"
+	case ui.state.phase == phaseOver && ui.state.rematchOffered:
+		state = ui.state.result + " " + opponent + " wants a rematch, press n to accept"
+	case ui.state.phase == phaseOver && !ui.state.spectator:
+		state = ui.state.result + " Press n for a rematch"
+	case ui.state.phase == phaseOver:
+		state = ui.state.result
+	default:
+		state = ui.status
+	}
+
+	title := fmt.Sprintf("%s vs %s  |  %s", nickname, opponent, state)
+	if score := ui.state.score(); score != "" {
+		title = fmt.Sprintf("%s vs %s  |  %s  |  %s", nickname, opponent, score, state)
+	}
+	switch {
+	case ui.state.spectator:
+		title = fmt.Sprintf("Watching game %s  |  %s", ui.state.gameID, title)
+	case ui.state.gameID != "":
+		title = fmt.Sprintf("Game %s  |  %s", ui.state.gameID, title)
+	}
+	if ui.latency > 0 && ui.state.phase != phaseDisconnected {
+		title += "  |  " + formatLatency(ui.latency)
+	}
+	drawText(ui.screen, 1, 0, width-2, style.Bold(true), title)
+}
+
+func (ui *tui) drawBoard(x, y int) {
+	boardStyle := tcell.StyleDefault.Background(ui.theme.board)
+
+	if ui.state.myTurn && ui.drop == nil {
+		drawText(ui.screen, x+ui.cursor*cellWidth+2, y, 1, tcell.StyleDefault.Bold(true), "▼")
+	}
+
+	for row := 0; row < ROWS; row++ {
+		for col := 0; col < COLS; col++ {
+			symbol := " "
+			if row < len(ui.state.board) && col < len(ui.state.board[row]) {
+				symbol = ui.state.board[row][col]
+			}
+
+			// While a disc falls, its final cell stays empty and it is drawn in
+			// the row it is passing through
+			if d := ui.drop; d != nil && d.col == col {
+				if row == d.target {
+					symbol = " "
+				}
+				if row == d.row {
+					symbol = d.symbol
+				}
+			}
+
+			cellX := x + col*cellWidth
+			drawText(ui.screen, cellX, y+1+row, cellWidth+1, boardStyle, "│   │")
+			ui.drawDisc(cellX+2, y+1+row, symbol, boardStyle)
+		}
+	}
+
+	for col := 0; col < COLS; col++ {
+		style := tcell.StyleDefault
+		if col == ui.cursor {
+			style = style.Bold(true).Underline(true)
+		}
+		drawText(ui.screen, x+col*cellWidth+2, y+1+ROWS, 1, style, fmt.Sprint(col+1))
+	}
+}
+
+func (ui *tui) drawDisc(x, y int, symbol string, style tcell.Style) {
+	if symbol == " " {
+		return
+	}
+
+	color, ok := ui.theme.discs[symbol]
+	if !ok {
+		// Themes without colors tell the players apart by their symbols
+		drawText(ui.screen, x, y, 1, style.Bold(true), symbol)
+		return
+	}
+	drawText(ui.screen, x, y, 1, style.Foreground(color), "●")
+}
+
+func (ui *tui) drawEvents(x, y, width, height int) {
+	if width <= 0 || height <= 1 {
+		return
+	}
+
+	title := "Events"
+	if ui.scroll > 0 {
+		title = fmt.Sprintf("Events (%d more below)", ui.scroll)
+	}
+	drawText(ui.screen, x, y, width, tcell.StyleDefault.Bold(true), title)
+
+	end := len(ui.events) - ui.scroll
+	start := max(end-(height-1), 0)
+	for i, event := range ui.events[start:end] {
+		drawText(ui.screen, x, y+1+i, width, tcell.StyleDefault, event)
+	}
+}
+
+// drawText writes text from (x, y), cutting it at maxWidth cells.
+func drawText(screen tcell.Screen, x, y, maxWidth int, style tcell.Style, text string) {
+	for _, r := range text {
+		if maxWidth <= 0 {
+			return
+		}
+		screen.SetContent(x, y, r, nil, style)
+		x++
+		maxWidth--
+	}
+}
@@ -0,0 +1,122 @@
+// Command gencerts generates a self-signed CA plus server and client
+// certificates signed by it, to try TLS and mutual TLS locally.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	outDir := flag.String("out", "certs", "directory where the certificates are written")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "comma-separated host names and IPs of the server certificate")
+	clients := flag.String("clients", "", "comma-separated nicknames to issue client certificates for")
+	validFor := flag.Duration("valid-for", 365*24*time.Hour, "validity of the generated certificates")
+	flag.Parse()
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatalf("failed to create %s: %v", *outDir, err)
+	}
+
+	caTemplate := newTemplate("Connect Four local CA", *validFor)
+	caTemplate.IsCA = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	caTemplate.BasicConstraintsValid = true
+
+	caCert, caKey := issue(*outDir, "ca", caTemplate, nil, nil)
+
+	serverTemplate := newTemplate("localhost", *validFor)
+	serverTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range splitList(*hosts) {
+		if ip := net.ParseIP(host); ip != nil {
+			serverTemplate.IPAddresses = append(serverTemplate.IPAddresses, ip)
+		} else {
+			serverTemplate.DNSNames = append(serverTemplate.DNSNames, host)
+		}
+	}
+	issue(*outDir, "server", serverTemplate, caCert, caKey)
+
+	// The common name of a client certificate is the identity of the player
+	for _, nickname := range splitList(*clients) {
+		clientTemplate := newTemplate(nickname, *validFor)
+		clientTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		issue(*outDir, "client-"+nickname, clientTemplate, caCert, caKey)
+	}
+}
+
+func newTemplate(commonName string, validFor time.Duration) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		log.Fatalf("failed to generate serial number: %v", err)
+	}
+
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Connect Four"}},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+}
+
+// issue creates a key pair, signs the template with the parent (or with
+// itself when parent is nil) and writes <name>.pem and <name>-key.pem.
+func issue(dir, name string, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalf("failed to generate key for %s: %v", name, err)
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		log.Fatalf("failed to create certificate %s: %v", name, err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		log.Fatalf("failed to encode key for %s: %v", name, err)
+	}
+
+	writePEM(filepath.Join(dir, name+".pem"), "CERTIFICATE", der, 0o644)
+	writePEM(filepath.Join(dir, name+"-key.pem"), "EC PRIVATE KEY", keyDER, 0o600)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		log.Fatalf("failed to parse certificate %s: %v", name, err)
+	}
+	return cert, key
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, perm); err != nil {
+		log.Fatalf("failed to write %s: %v", path, err)
+	}
+	log.Printf("wrote %s", path)
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
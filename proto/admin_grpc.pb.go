@@ -0,0 +1,462 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v3.12.4
+// source: admin.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Admin_ListGames_FullMethodName      = "/connect4.Admin/ListGames"
+	Admin_ListPlayers_FullMethodName    = "/connect4.Admin/ListPlayers"
+	Admin_InspectGame_FullMethodName    = "/connect4.Admin/InspectGame"
+	Admin_EndGame_FullMethodName        = "/connect4.Admin/EndGame"
+	Admin_KickPlayer_FullMethodName     = "/connect4.Admin/KickPlayer"
+	Admin_BanPlayer_FullMethodName      = "/connect4.Admin/BanPlayer"
+	Admin_UnbanPlayer_FullMethodName    = "/connect4.Admin/UnbanPlayer"
+	Admin_ListBans_FullMethodName       = "/connect4.Admin/ListBans"
+	Admin_Announce_FullMethodName       = "/connect4.Admin/Announce"
+	Admin_SetMaintenance_FullMethodName = "/connect4.Admin/SetMaintenance"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	// Lists the games on the server, like Connect4Game.ListGames.
+	ListGames(ctx context.Context, in *ListGamesRequest, opts ...grpc.CallOption) (*Lobby, error)
+	// Lists the players and spectators of every game.
+	ListPlayers(ctx context.Context, in *ListPlayersRequest, opts ...grpc.CallOption) (*ConnectedPlayers, error)
+	// Returns the full state of a game, with its connections and chat.
+	InspectGame(ctx context.Context, in *InspectGameRequest, opts ...grpc.CallOption) (*GameInspection, error)
+	// Ends a game in progress with a result, or aborts it without one.
+	EndGame(ctx context.Context, in *EndGameRequest, opts ...grpc.CallOption) (*AdminResponse, error)
+	// Disconnects every session of a player. Logged in players can come back
+	// to their games, unless they are banned too.
+	KickPlayer(ctx context.Context, in *KickPlayerRequest, opts ...grpc.CallOption) (*AdminResponse, error)
+	// Kicks a player and keeps the nickname from logging in or playing.
+	BanPlayer(ctx context.Context, in *BanPlayerRequest, opts ...grpc.CallOption) (*AdminResponse, error)
+	UnbanPlayer(ctx context.Context, in *UnbanPlayerRequest, opts ...grpc.CallOption) (*AdminResponse, error)
+	ListBans(ctx context.Context, in *ListBansRequest, opts ...grpc.CallOption) (*BanList, error)
+	// Sends a message to everyone in a game, players and spectators.
+	Announce(ctx context.Context, in *AnnounceRequest, opts ...grpc.CallOption) (*AdminResponse, error)
+	// In maintenance mode the games in progress go on, but no new game
+	// starts.
+	SetMaintenance(ctx context.Context, in *SetMaintenanceRequest, opts ...grpc.CallOption) (*MaintenanceStatus, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListGames(ctx context.Context, in *ListGamesRequest, opts ...grpc.CallOption) (*Lobby, error) {
+	out := new(Lobby)
+	err := c.cc.Invoke(ctx, Admin_ListGames_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListPlayers(ctx context.Context, in *ListPlayersRequest, opts ...grpc.CallOption) (*ConnectedPlayers, error) {
+	out := new(ConnectedPlayers)
+	err := c.cc.Invoke(ctx, Admin_ListPlayers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) InspectGame(ctx context.Context, in *InspectGameRequest, opts ...grpc.CallOption) (*GameInspection, error) {
+	out := new(GameInspection)
+	err := c.cc.Invoke(ctx, Admin_InspectGame_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) EndGame(ctx context.Context, in *EndGameRequest, opts ...grpc.CallOption) (*AdminResponse, error) {
+	out := new(AdminResponse)
+	err := c.cc.Invoke(ctx, Admin_EndGame_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) KickPlayer(ctx context.Context, in *KickPlayerRequest, opts ...grpc.CallOption) (*AdminResponse, error) {
+	out := new(AdminResponse)
+	err := c.cc.Invoke(ctx, Admin_KickPlayer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) BanPlayer(ctx context.Context, in *BanPlayerRequest, opts ...grpc.CallOption) (*AdminResponse, error) {
+	out := new(AdminResponse)
+	err := c.cc.Invoke(ctx, Admin_BanPlayer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) UnbanPlayer(ctx context.Context, in *UnbanPlayerRequest, opts ...grpc.CallOption) (*AdminResponse, error) {
+	out := new(AdminResponse)
+	err := c.cc.Invoke(ctx, Admin_UnbanPlayer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListBans(ctx context.Context, in *ListBansRequest, opts ...grpc.CallOption) (*BanList, error) {
+	out := new(BanList)
+	err := c.cc.Invoke(ctx, Admin_ListBans_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Announce(ctx context.Context, in *AnnounceRequest, opts ...grpc.CallOption) (*AdminResponse, error) {
+	out := new(AdminResponse)
+	err := c.cc.Invoke(ctx, Admin_Announce_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetMaintenance(ctx context.Context, in *SetMaintenanceRequest, opts ...grpc.CallOption) (*MaintenanceStatus, error) {
+	out := new(MaintenanceStatus)
+	err := c.cc.Invoke(ctx, Admin_SetMaintenance_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	// Lists the games on the server, like Connect4Game.ListGames.
+	ListGames(context.Context, *ListGamesRequest) (*Lobby, error)
+	// Lists the players and spectators of every game.
+	ListPlayers(context.Context, *ListPlayersRequest) (*ConnectedPlayers, error)
+	// Returns the full state of a game, with its connections and chat.
+	InspectGame(context.Context, *InspectGameRequest) (*GameInspection, error)
+	// Ends a game in progress with a result, or aborts it without one.
+	EndGame(context.Context, *EndGameRequest) (*AdminResponse, error)
+	// Disconnects every session of a player. Logged in players can come back
+	// to their games, unless they are banned too.
+	KickPlayer(context.Context, *KickPlayerRequest) (*AdminResponse, error)
+	// Kicks a player and keeps the nickname from logging in or playing.
+	BanPlayer(context.Context, *BanPlayerRequest) (*AdminResponse, error)
+	UnbanPlayer(context.Context, *UnbanPlayerRequest) (*AdminResponse, error)
+	ListBans(context.Context, *ListBansRequest) (*BanList, error)
+	// Sends a message to everyone in a game, players and spectators.
+	Announce(context.Context, *AnnounceRequest) (*AdminResponse, error)
+	// In maintenance mode the games in progress go on, but no new game
+	// starts.
+	SetMaintenance(context.Context, *SetMaintenanceRequest) (*MaintenanceStatus, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) ListGames(context.Context, *ListGamesRequest) (*Lobby, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListGames not implemented")
+}
+func (UnimplementedAdminServer) ListPlayers(context.Context, *ListPlayersRequest) (*ConnectedPlayers, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPlayers not implemented")
+}
+func (UnimplementedAdminServer) InspectGame(context.Context, *InspectGameRequest) (*GameInspection, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InspectGame not implemented")
+}
+func (UnimplementedAdminServer) EndGame(context.Context, *EndGameRequest) (*AdminResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EndGame not implemented")
+}
+func (UnimplementedAdminServer) KickPlayer(context.Context, *KickPlayerRequest) (*AdminResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KickPlayer not implemented")
+}
+func (UnimplementedAdminServer) BanPlayer(context.Context, *BanPlayerRequest) (*AdminResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BanPlayer not implemented")
+}
+func (UnimplementedAdminServer) UnbanPlayer(context.Context, *UnbanPlayerRequest) (*AdminResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnbanPlayer not implemented")
+}
+func (UnimplementedAdminServer) ListBans(context.Context, *ListBansRequest) (*BanList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBans not implemented")
+}
+func (UnimplementedAdminServer) Announce(context.Context, *AnnounceRequest) (*AdminResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Announce not implemented")
+}
+func (UnimplementedAdminServer) SetMaintenance(context.Context, *SetMaintenanceRequest) (*MaintenanceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetMaintenance not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_ListGames_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGamesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListGames(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListGames_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListGames(ctx, req.(*ListGamesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListPlayers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPlayersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListPlayers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListPlayers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListPlayers(ctx, req.(*ListPlayersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_InspectGame_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InspectGameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).InspectGame(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_InspectGame_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).InspectGame(ctx, req.(*InspectGameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_EndGame_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EndGameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).EndGame(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_EndGame_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).EndGame(ctx, req.(*EndGameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_KickPlayer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KickPlayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).KickPlayer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_KickPlayer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).KickPlayer(ctx, req.(*KickPlayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_BanPlayer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BanPlayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).BanPlayer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_BanPlayer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).BanPlayer(ctx, req.(*BanPlayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_UnbanPlayer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnbanPlayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).UnbanPlayer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_UnbanPlayer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).UnbanPlayer(ctx, req.(*UnbanPlayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListBans_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBansRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListBans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListBans_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListBans(ctx, req.(*ListBansRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Announce_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnnounceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Announce(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_Announce_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Announce(ctx, req.(*AnnounceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetMaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_SetMaintenance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetMaintenance(ctx, req.(*SetMaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "connect4.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListGames",
+			Handler:    _Admin_ListGames_Handler,
+		},
+		{
+			MethodName: "ListPlayers",
+			Handler:    _Admin_ListPlayers_Handler,
+		},
+		{
+			MethodName: "InspectGame",
+			Handler:    _Admin_InspectGame_Handler,
+		},
+		{
+			MethodName: "EndGame",
+			Handler:    _Admin_EndGame_Handler,
+		},
+		{
+			MethodName: "KickPlayer",
+			Handler:    _Admin_KickPlayer_Handler,
+		},
+		{
+			MethodName: "BanPlayer",
+			Handler:    _Admin_BanPlayer_Handler,
+		},
+		{
+			MethodName: "UnbanPlayer",
+			Handler:    _Admin_UnbanPlayer_Handler,
+		},
+		{
+			MethodName: "ListBans",
+			Handler:    _Admin_ListBans_Handler,
+		},
+		{
+			MethodName: "Announce",
+			Handler:    _Admin_Announce_Handler,
+		},
+		{
+			MethodName: "SetMaintenance",
+			Handler:    _Admin_SetMaintenance_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
@@ -0,0 +1,9 @@
+package proto
+
+import _ "embed"
+
+// OpenAPI describes the REST API of the gateway, in the OpenAPI 2.0 format.
+// It is generated from the HTTP annotations of service.proto.
+//
+//go:embed service.swagger.json
+var OpenAPI []byte
@@ -21,6 +21,12 @@ const _ = grpc.SupportPackageIsVersion7
 const (
 	Connect4Game_GameSession_FullMethodName = "/connect4.Connect4Game/GameSession"
 	Connect4Game_Connect_FullMethodName     = "/connect4.Connect4Game/Connect"
+	Connect4Game_Register_FullMethodName    = "/connect4.Connect4Game/Register"
+	Connect4Game_Login_FullMethodName       = "/connect4.Connect4Game/Login"
+	Connect4Game_ListGames_FullMethodName   = "/connect4.Connect4Game/ListGames"
+	Connect4Game_CreateGame_FullMethodName  = "/connect4.Connect4Game/CreateGame"
+	Connect4Game_GetGame_FullMethodName     = "/connect4.Connect4Game/GetGame"
+	Connect4Game_GetPlayer_FullMethodName   = "/connect4.Connect4Game/GetPlayer"
 )
 
 // Connect4GameClient is the client API for Connect4Game service.
@@ -33,6 +39,24 @@ type Connect4GameClient interface {
 	// Once the server has started the stream, the client can
 	// send the first message in order to connect and start the game.
 	Connect(ctx context.Context, in *ConnectRequest, opts ...grpc.CallOption) (*ConnectResponse, error)
+	// Register creates an account that reserves a nickname behind a password.
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	// Login checks the credentials of a registered account and returns a
+	// signed session token. The token must be sent in the "authorization"
+	// metadata ("Bearer <token>") of the following RPCs.
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error)
+	// ListGames returns the same Lobby as the "list" command of GameSession.
+	ListGames(ctx context.Context, in *ListGamesRequest, opts ...grpc.CallOption) (*Lobby, error)
+	// CreateGame opens a game without taking a seat at it. The first player
+	// to "join" it with the returned game_id is its creator, for the
+	// options. Games nobody joins are discarded after a few minutes.
+	CreateGame(ctx context.Context, in *CreateGameRequest, opts ...grpc.CallOption) (*GameSummary, error)
+	// GetGame returns the record of a game on the server: its board, the
+	// moves of the current game and the score of the series.
+	GetGame(ctx context.Context, in *GetGameRequest, opts ...grpc.CallOption) (*GameRecord, error)
+	// GetPlayer returns the profile of a registered player, or of a guest
+	// seated at a game.
+	GetPlayer(ctx context.Context, in *GetPlayerRequest, opts ...grpc.CallOption) (*PlayerProfile, error)
 }
 
 type connect4GameClient struct {
@@ -83,6 +107,60 @@ func (c *connect4GameClient) Connect(ctx context.Context, in *ConnectRequest, op
 	return out, nil
 }
 
+func (c *connect4GameClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, Connect4Game_Register_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connect4GameClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error) {
+	out := new(LoginResponse)
+	err := c.cc.Invoke(ctx, Connect4Game_Login_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connect4GameClient) ListGames(ctx context.Context, in *ListGamesRequest, opts ...grpc.CallOption) (*Lobby, error) {
+	out := new(Lobby)
+	err := c.cc.Invoke(ctx, Connect4Game_ListGames_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connect4GameClient) CreateGame(ctx context.Context, in *CreateGameRequest, opts ...grpc.CallOption) (*GameSummary, error) {
+	out := new(GameSummary)
+	err := c.cc.Invoke(ctx, Connect4Game_CreateGame_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connect4GameClient) GetGame(ctx context.Context, in *GetGameRequest, opts ...grpc.CallOption) (*GameRecord, error) {
+	out := new(GameRecord)
+	err := c.cc.Invoke(ctx, Connect4Game_GetGame_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *connect4GameClient) GetPlayer(ctx context.Context, in *GetPlayerRequest, opts ...grpc.CallOption) (*PlayerProfile, error) {
+	out := new(PlayerProfile)
+	err := c.cc.Invoke(ctx, Connect4Game_GetPlayer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Connect4GameServer is the server API for Connect4Game service.
 // All implementations must embed UnimplementedConnect4GameServer
 // for forward compatibility
@@ -93,6 +171,24 @@ type Connect4GameServer interface {
 	// Once the server has started the stream, the client can
 	// send the first message in order to connect and start the game.
 	Connect(context.Context, *ConnectRequest) (*ConnectResponse, error)
+	// Register creates an account that reserves a nickname behind a password.
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	// Login checks the credentials of a registered account and returns a
+	// signed session token. The token must be sent in the "authorization"
+	// metadata ("Bearer <token>") of the following RPCs.
+	Login(context.Context, *LoginRequest) (*LoginResponse, error)
+	// ListGames returns the same Lobby as the "list" command of GameSession.
+	ListGames(context.Context, *ListGamesRequest) (*Lobby, error)
+	// CreateGame opens a game without taking a seat at it. The first player
+	// to "join" it with the returned game_id is its creator, for the
+	// options. Games nobody joins are discarded after a few minutes.
+	CreateGame(context.Context, *CreateGameRequest) (*GameSummary, error)
+	// GetGame returns the record of a game on the server: its board, the
+	// moves of the current game and the score of the series.
+	GetGame(context.Context, *GetGameRequest) (*GameRecord, error)
+	// GetPlayer returns the profile of a registered player, or of a guest
+	// seated at a game.
+	GetPlayer(context.Context, *GetPlayerRequest) (*PlayerProfile, error)
 	mustEmbedUnimplementedConnect4GameServer()
 }
 
@@ -106,6 +202,24 @@ func (UnimplementedConnect4GameServer) GameSession(Connect4Game_GameSessionServe
 func (UnimplementedConnect4GameServer) Connect(context.Context, *ConnectRequest) (*ConnectResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Connect not implemented")
 }
+func (UnimplementedConnect4GameServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedConnect4GameServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedConnect4GameServer) ListGames(context.Context, *ListGamesRequest) (*Lobby, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListGames not implemented")
+}
+func (UnimplementedConnect4GameServer) CreateGame(context.Context, *CreateGameRequest) (*GameSummary, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateGame not implemented")
+}
+func (UnimplementedConnect4GameServer) GetGame(context.Context, *GetGameRequest) (*GameRecord, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetGame not implemented")
+}
+func (UnimplementedConnect4GameServer) GetPlayer(context.Context, *GetPlayerRequest) (*PlayerProfile, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPlayer not implemented")
+}
 func (UnimplementedConnect4GameServer) mustEmbedUnimplementedConnect4GameServer() {}
 
 // UnsafeConnect4GameServer may be embedded to opt out of forward compatibility for this service.
@@ -163,6 +277,114 @@ func _Connect4Game_Connect_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Connect4Game_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Connect4GameServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Connect4Game_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Connect4GameServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connect4Game_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Connect4GameServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Connect4Game_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Connect4GameServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connect4Game_ListGames_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGamesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Connect4GameServer).ListGames(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Connect4Game_ListGames_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Connect4GameServer).ListGames(ctx, req.(*ListGamesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connect4Game_CreateGame_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateGameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Connect4GameServer).CreateGame(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Connect4Game_CreateGame_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Connect4GameServer).CreateGame(ctx, req.(*CreateGameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connect4Game_GetGame_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Connect4GameServer).GetGame(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Connect4Game_GetGame_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Connect4GameServer).GetGame(ctx, req.(*GetGameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Connect4Game_GetPlayer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPlayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Connect4GameServer).GetPlayer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Connect4Game_GetPlayer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Connect4GameServer).GetPlayer(ctx, req.(*GetPlayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Connect4Game_ServiceDesc is the grpc.ServiceDesc for Connect4Game service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -174,6 +396,30 @@ var Connect4Game_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Connect",
 			Handler:    _Connect4Game_Connect_Handler,
 		},
+		{
+			MethodName: "Register",
+			Handler:    _Connect4Game_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _Connect4Game_Login_Handler,
+		},
+		{
+			MethodName: "ListGames",
+			Handler:    _Connect4Game_ListGames_Handler,
+		},
+		{
+			MethodName: "CreateGame",
+			Handler:    _Connect4Game_CreateGame_Handler,
+		},
+		{
+			MethodName: "GetGame",
+			Handler:    _Connect4Game_GetGame_Handler,
+		},
+		{
+			MethodName: "GetPlayer",
+			Handler:    _Connect4Game_GetPlayer_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
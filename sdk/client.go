@@ -0,0 +1,193 @@
+// Package sdk is a client for the Connect Four server. It wraps the
+// generated gRPC client so bots and tools can play without handling the
+// GameSession stream themselves:
+//
+//	client, err := sdk.Connect(ctx, "localhost:50051")
+//	...
+//	game, err := client.JoinGame(ctx, "", "bot")
+//	for event := range game.Events() {
+//		...
+//		game.Move(3)
+//	}
+package sdk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+// Client is a connection to a Connect Four server. It is safe for concurrent
+// use, and a single client can play several games at once.
+type Client struct {
+	conn *grpc.ClientConn
+	rpc  connect4.Connect4GameClient
+	opts options
+
+	lock  sync.Mutex
+	token string // Session token sent with every game, empty for guests
+}
+
+type options struct {
+	creds       credentials.TransportCredentials
+	token       string
+	dialOptions []grpc.DialOption
+
+	reconnectAttempts int
+	reconnectBackoff  time.Duration
+
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+// WithTransportCredentials sets the credentials used to dial the server. The
+// connection is not encrypted by default.
+func WithTransportCredentials(creds credentials.TransportCredentials) Option {
+	return func(o *options) { o.creds = creds }
+}
+
+// WithToken logs in with a session token saved from an earlier Login.
+func WithToken(token string) Option {
+	return func(o *options) { o.token = token }
+}
+
+// WithReconnect makes games that lose the connection to the server try to
+// rejoin up to attempts times, waiting backoff before the first attempt and
+// twice as long before each of the next ones. The server only gives the seat
+// back to logged in players, so guests only reconnect when spectating.
+func WithReconnect(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.reconnectAttempts = attempts
+		o.reconnectBackoff = backoff
+	}
+}
+
+// WithHeartbeat pings the server every interval, reporting the latency of
+// the games as Latency events, and gives the connection up as lost when
+// nothing comes from the server for timeout, which makes games reconnect
+// like after any other network failure. The connection also sends gRPC
+// keepalives at the same interval. The default is to ping every 15 seconds
+// with a timeout of 45 seconds; an interval of 0 disables the pings.
+func WithHeartbeat(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		o.heartbeatInterval = interval
+		o.heartbeatTimeout = timeout
+	}
+}
+
+// WithDialOptions adds options to the gRPC connection.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOptions = append(o.dialOptions, opts...) }
+}
+
+// Connect dials the server at addr, blocking until the connection is up or
+// ctx is done.
+func Connect(ctx context.Context, addr string, opts ...Option) (*Client, error) {
+	o := options{creds: insecure.NewCredentials(), heartbeatInterval: 15 * time.Second, heartbeatTimeout: 45 * time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.heartbeatInterval > 0 && o.heartbeatTimeout <= o.heartbeatInterval {
+		return nil, errors.New("the heartbeat timeout must be longer than the interval")
+	}
+
+	// Calls carry the trace of ctx when the program set up OpenTelemetry
+	dialOptions := []grpc.DialOption{grpc.WithTransportCredentials(o.creds), grpc.WithBlock(), grpc.WithStatsHandler(otelgrpc.NewClientHandler())}
+	if o.heartbeatInterval > 0 {
+		dialOptions = append(dialOptions, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                o.heartbeatInterval,
+			Timeout:             o.heartbeatTimeout - o.heartbeatInterval,
+			PermitWithoutStream: true,
+		}))
+	}
+	dialOptions = append(dialOptions, o.dialOptions...)
+	conn, err := grpc.DialContext(ctx, addr, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn, rpc: connect4.NewConnect4GameClient(conn), opts: o, token: o.token}, nil
+}
+
+// Register creates an account for nickname.
+func (c *Client) Register(ctx context.Context, nickname, password string) error {
+	_, err := c.rpc.Register(ctx, &connect4.RegisterRequest{Nickname: nickname, Password: password})
+	return err
+}
+
+// Login authenticates the player. The games opened afterwards are played
+// under the account's nickname.
+func (c *Client) Login(ctx context.Context, nickname, password string) (*connect4.LoginResponse, error) {
+	res, err := c.rpc.Login(ctx, &connect4.LoginRequest{Nickname: nickname, Password: password})
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.token = res.Token
+	c.lock.Unlock()
+
+	return res, nil
+}
+
+// Token returns the session token of the client, or "" when playing as a
+// guest.
+func (c *Client) Token() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.token
+}
+
+// RPC returns the generated client, for calls the SDK doesn't wrap.
+func (c *Client) RPC() connect4.Connect4GameClient {
+	return c.rpc
+}
+
+// Close closes the connection, ending every game of the client.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// CreateGame opens a new game and waits there for an opponent. Guests play
+// as nickname, which is ignored after Login. options choose who moves first
+// and the creator's symbol; nil uses the defaults of the server. The game is
+// left when ctx is done.
+func (c *Client) CreateGame(ctx context.Context, nickname string, options *connect4.GameOptions) (*Game, error) {
+	return c.openGame(ctx, &connect4.GameCommand{Command: "create", Nickname: nickname, Options: options})
+}
+
+// JoinGame takes a seat at the game with the given ID. An empty ID joins the
+// game that has been waiting the longest for an opponent, or opens a new one.
+func (c *Client) JoinGame(ctx context.Context, gameID, nickname string) (*Game, error) {
+	command := "join"
+	if gameID == "" {
+		command = "connect"
+	}
+	return c.openGame(ctx, &connect4.GameCommand{Command: command, Nickname: nickname, GameId: gameID})
+}
+
+// SpectateGame watches the game with the given ID without taking a seat.
+// Spectators can chat with each other and read the players' chat.
+func (c *Client) SpectateGame(ctx context.Context, gameID, nickname string) (*Game, error) {
+	return c.openGame(ctx, &connect4.GameCommand{Command: "spectate", Nickname: nickname, GameId: gameID})
+}
+
+// withToken adds the session token, if any, to the outgoing metadata of ctx.
+func (c *Client) withToken(ctx context.Context) context.Context {
+	if token := c.Token(); token != "" {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	return ctx
+}
@@ -0,0 +1,327 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Event is something that happened to a game: an Update sent by the server,
+// Reconnecting and Reconnected while the SDK recovers a lost connection, or
+// Latency when the server answers a ping.
+type Event interface {
+	isEvent()
+}
+
+// Update is a message sent by the server. Its Event field tells what changed.
+type Update struct {
+	*connect4.GameUpdate
+}
+
+// Reconnecting reports that the connection was lost and the SDK is about to
+// try to rejoin the game for the Attempt-th time.
+type Reconnecting struct {
+	Attempt int
+	Err     error // Error that closed the previous stream
+}
+
+// Reconnected reports that the game was rejoined. The server sends the
+// current state of the game right after it.
+type Reconnected struct{}
+
+// Latency reports the round trip of a ping to the server.
+type Latency struct {
+	RoundTrip time.Duration
+}
+
+func (Update) isEvent()       {}
+func (Reconnecting) isEvent() {}
+func (Reconnected) isEvent()  {}
+func (Latency) isEvent()      {}
+
+// errServerGone closes a stream on which the server stopped answering pings.
+// Like the network failures reported by gRPC, it makes the game reconnect.
+var errServerGone = status.Error(codes.Unavailable, "the server stopped answering pings")
+
+// Game is a seat at a game on the server. Events must be drained for the game
+// to make progress.
+type Game struct {
+	client    *Client
+	id        string
+	nickname  string
+	spectator bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sendLock    sync.Mutex // Guards the stream fields, which change on reconnection
+	stream      connect4.Connect4Game_GameSessionClient
+	streamCtx   context.Context
+	closeStream context.CancelCauseFunc
+
+	lastReceived atomic.Int64 // Unix nanoseconds of the last message of the server
+	latency      atomic.Int64 // Round trip of the last ping
+
+	events chan Event
+	ended  chan struct{} // Closed with events, stopping the heartbeat
+	err    error         // Set before events is closed
+	over   bool          // Set once the server announced the result, only touched by receive
+}
+
+// openGame opens a game session and sends the join command, returning once
+// the server seated the player. The game is left when ctx is done.
+func (c *Client) openGame(ctx context.Context, command *connect4.GameCommand) (*Game, error) {
+	gameCtx, cancel := context.WithCancel(ctx)
+	g := &Game{client: c, nickname: command.Nickname, spectator: command.Command == "spectate", ctx: gameCtx, cancel: cancel, events: make(chan Event, 16), ended: make(chan struct{})}
+
+	welcome, err := g.open(command)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	g.id = welcome.GetWelcome().GetGameId()
+	g.events <- Update{welcome}
+
+	go g.receive()
+	go g.heartbeat()
+	return g, nil
+}
+
+// open starts a new stream and waits for the welcome message of the server.
+func (g *Game) open(command *connect4.GameCommand) (*connect4.GameUpdate, error) {
+	ctx, closeStream := context.WithCancelCause(g.ctx)
+	stream, err := g.client.rpc.GameSession(g.client.withToken(ctx))
+	if err != nil {
+		closeStream(nil)
+		return nil, err
+	}
+	if err := stream.Send(command); err != nil {
+		_, err = stream.Recv() // Send only reports io.EOF, the actual error comes from Recv
+		closeStream(nil)
+		return nil, err
+	}
+
+	welcome, err := stream.Recv()
+	if err != nil {
+		closeStream(nil)
+		return nil, err
+	}
+	g.lastReceived.Store(time.Now().UnixNano())
+
+	g.sendLock.Lock()
+	if g.closeStream != nil {
+		g.closeStream(nil) // The stream that was lost
+	}
+	g.stream, g.streamCtx, g.closeStream = stream, ctx, closeStream
+	g.sendLock.Unlock()
+
+	return welcome, nil
+}
+
+// receive forwards the messages of the server to the events channel,
+// rejoining the game when the connection is lost.
+func (g *Game) receive() {
+	defer close(g.events)
+	defer close(g.ended)
+
+	for {
+		g.sendLock.Lock()
+		stream, streamCtx := g.stream, g.streamCtx
+		g.sendLock.Unlock()
+
+		in, err := stream.Recv()
+		if err != nil {
+			if g.ctx.Err() != nil || err == io.EOF {
+				return // Closed by the player or by the server
+			}
+			if cause := context.Cause(streamCtx); cause != nil {
+				err = cause // Closed by the heartbeat
+			}
+			if !g.reconnect(err) {
+				return
+			}
+			continue
+		}
+		g.lastReceived.Store(time.Now().UnixNano())
+
+		switch {
+		case in.GetPing() != nil:
+			g.send(&connect4.GameCommand{Command: "pong", SentAt: in.GetPing().SentAt})
+			continue
+		case in.GetPong() != nil:
+			roundTrip := time.Since(time.UnixMicro(in.GetPong().SentAt))
+			g.latency.Store(int64(roundTrip))
+			if !g.emit(Latency{RoundTrip: roundTrip}) {
+				return
+			}
+			continue
+		case in.GetGameOver() != nil:
+			g.over = true
+		case in.GetGameStarted() != nil:
+			g.over = false // A rematch began
+		}
+		if !g.emit(Update{in}) {
+			return
+		}
+	}
+}
+
+// heartbeat pings the server every heartbeat interval, and closes the
+// stream when the server stays silent for longer than the timeout, so the
+// game reconnects instead of waiting on a dead connection.
+func (g *Game) heartbeat() {
+	interval, timeout := g.client.opts.heartbeatInterval, g.client.opts.heartbeatTimeout
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// The first ping measures the latency right away
+	g.send(&connect4.GameCommand{Command: "ping", SentAt: time.Now().UnixMicro()})
+	for {
+		select {
+		case <-ticker.C:
+		case <-g.ended:
+			return
+		}
+
+		if time.Since(time.Unix(0, g.lastReceived.Load())) > timeout {
+			g.sendLock.Lock()
+			g.closeStream(errServerGone)
+			g.sendLock.Unlock()
+			continue
+		}
+		g.send(&connect4.GameCommand{Command: "ping", SentAt: time.Now().UnixMicro()})
+	}
+}
+
+// reconnect tries to rejoin the game after err closed the stream. It reports
+// whether it succeeded, setting g.err otherwise.
+func (g *Game) reconnect(err error) bool {
+	attempts := g.client.opts.reconnectAttempts
+	if status.Code(err) != codes.Unavailable || !g.spectator && (g.over || g.client.Token() == "") {
+		attempts = 0 // Nothing to go back to
+	}
+
+	rejoin := &connect4.GameCommand{Command: "join", Nickname: g.nickname, GameId: g.id}
+	if g.spectator {
+		rejoin.Command = "spectate"
+	}
+
+	backoff := g.client.opts.reconnectBackoff
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if !g.emit(Reconnecting{Attempt: attempt, Err: err}) {
+			return false
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-g.ctx.Done():
+			return false
+		}
+		backoff *= 2
+
+		welcome, joinErr := g.open(rejoin)
+		if joinErr == nil {
+			return g.emit(Reconnected{}) && g.emit(Update{welcome})
+		}
+		if status.Code(joinErr) != codes.Unavailable {
+			err = joinErr // The game can't be rejoined anymore
+			break
+		}
+	}
+
+	g.err = err
+	return false
+}
+
+// emit delivers an event, giving up when the game is closed.
+func (g *Game) emit(event Event) bool {
+	select {
+	case g.events <- event:
+		return true
+	case <-g.ctx.Done():
+		return false
+	}
+}
+
+// ID returns the ID of the game, which other players can use to join it.
+func (g *Game) ID() string {
+	return g.id
+}
+
+// Events returns the events of the game. The channel is closed when the game
+// session ends, after which Err tells why.
+func (g *Game) Events() <-chan Event {
+	return g.events
+}
+
+// Err returns the error that ended the game session, or nil if it was closed
+// by the player or the server. It must only be called after Events is closed.
+func (g *Game) Err() error {
+	return g.err
+}
+
+// Move drops a disc in column, counted from 0.
+func (g *Game) Move(column int) error {
+	return g.send(&connect4.GameCommand{Command: "move", Column: int32(column)})
+}
+
+// Resign gives up the game.
+func (g *Game) Resign() error {
+	return g.send(&connect4.GameCommand{Command: "resign"})
+}
+
+// Rematch offers the opponent another game once this one is over, or
+// accepts the opponent's offer. The new game is played on the same Game,
+// starting with a GameStarted update.
+func (g *Game) Rematch() error {
+	return g.send(&connect4.GameCommand{Command: "rematch"})
+}
+
+// Chat sends a message to the game's chat. Players chat with each other,
+// while spectators chat in a channel only other spectators read.
+func (g *Game) Chat(text string) error {
+	return g.send(&connect4.GameCommand{Command: "chat", Text: text})
+}
+
+// Emote sends one of the server's emotes, such as "gg" or "wave", to the
+// game's chat.
+func (g *Game) Emote(name string) error {
+	return g.send(&connect4.GameCommand{Command: "emote", Text: name})
+}
+
+// Latency returns the round trip of the last ping to the server, or 0
+// before the server answered one.
+func (g *Game) Latency() time.Duration {
+	return time.Duration(g.latency.Load())
+}
+
+// Spectator reports whether the client watches the game without a seat.
+func (g *Game) Spectator() bool {
+	return g.spectator
+}
+
+func (g *Game) send(command *connect4.GameCommand) error {
+	if g.ctx.Err() != nil {
+		return errors.New("game closed")
+	}
+
+	g.sendLock.Lock()
+	defer g.sendLock.Unlock()
+	return g.stream.Send(command)
+}
+
+// Close leaves the game. The opponent wins if it was still being played.
+func (g *Game) Close() {
+	g.cancel()
+}
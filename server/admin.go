@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	bansFile     = "bans.json"
+	auditLogFile = "audit.log"
+)
+
+// adminServer implements the Admin service, for the operators of the
+// server.
+type adminServer struct {
+	connect4.UnimplementedAdminServer
+
+	s      *server
+	admins map[string]bool // Nicknames allowed to call the service, lower-cased
+	audit  *auditLog
+}
+
+// newAdminServer also reserves the nicknames of the admins on s, so that an
+// admin without an account can't be claimed by whoever registers it first.
+// Such an admin can only call the service with a client certificate.
+func newAdminServer(s *server, admins []string, audit *auditLog) *adminServer {
+	a := &adminServer{s: s, admins: make(map[string]bool), audit: audit}
+	s.reservedNicknames = make(map[string]bool)
+	for _, nickname := range admins {
+		a.admins[accountKey(nickname)] = true
+		s.reservedNicknames[accountKey(nickname)] = true
+		if !s.accounts.IsRegistered(nickname) {
+			slog.Warn("admin has no account, so only a client certificate can use it", "admin", nickname)
+		}
+	}
+	return a
+}
+
+// unaryInterceptor lets only the admins call the Admin service, and writes
+// every call to the audit log. It must run after the authentication
+// interceptor.
+func (a *adminServer) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !strings.HasPrefix(info.FullMethod, "/"+connect4.Admin_ServiceDesc.ServiceName+"/") {
+		return handler(ctx, req)
+	}
+
+	nickname, ok := playerFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "the admin service needs a logged in player")
+	}
+	if !a.admins[accountKey(nickname)] {
+		slog.WarnContext(ctx, "admin call denied")
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not an admin", nickname)
+	}
+
+	res, err := handler(ctx, req)
+	a.audit.record(ctx, nickname, info.FullMethod, req, err)
+	return res, err
+}
+
+func (a *adminServer) ListGames(ctx context.Context, req *connect4.ListGamesRequest) (*connect4.Lobby, error) {
+	return a.s.lobby(), nil
+}
+
+func (a *adminServer) ListPlayers(ctx context.Context, req *connect4.ListPlayersRequest) (*connect4.ConnectedPlayers, error) {
+	players := &connect4.ConnectedPlayers{}
+	for _, g := range a.s.sortedGames() {
+		g.do(func() {
+			for _, client := range g.players {
+				if client != nil {
+					players.Players = append(players.Players, client.connectedPlayer(g))
+				}
+			}
+			for _, client := range g.spectators {
+				players.Players = append(players.Players, client.connectedPlayer(g))
+			}
+		})
+	}
+	return players, nil
+}
+
+func (a *adminServer) InspectGame(ctx context.Context, req *connect4.InspectGameRequest) (*connect4.GameInspection, error) {
+	g, err := a.s.findGame(req.GameId)
+	if err != nil {
+		return nil, err
+	}
+
+	var inspection *connect4.GameInspection
+	inspected := g.do(func() {
+		inspection = &connect4.GameInspection{Record: g.record(), Chat: slices.Clone(g.chatHistory)}
+		for seat, client := range g.players {
+			if client == nil {
+				continue
+			}
+			inspection.Players = append(inspection.Players, client.connectedPlayer(g))
+			if g.rematchOffers[seat] {
+				inspection.RematchOffers = append(inspection.RematchOffers, client.Nickname)
+			}
+		}
+		for _, client := range g.spectators {
+			inspection.Spectators = append(inspection.Spectators, client.connectedPlayer(g))
+		}
+	})
+	if !inspected {
+		return nil, status.Errorf(codes.NotFound, "game %s not found", req.GameId)
+	}
+	return inspection, nil
+}
+
+func (a *adminServer) EndGame(ctx context.Context, req *connect4.EndGameRequest) (*connect4.AdminResponse, error) {
+	g, err := a.s.findGame(req.GameId)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "An operator ended the game."
+	if req.Reason != "" {
+		message = "An operator ended the game: " + req.Reason + "."
+	}
+
+	var empty bool
+	ended := g.do(func() {
+		if !g.started || g.gameOver {
+			err = status.Errorf(codes.FailedPrecondition, "game %s is not in progress", g.id)
+			return
+		}
+
+		switch req.Outcome {
+		case connect4.EndGameRequest_ABORT:
+			g.abort(message)
+		case connect4.EndGameRequest_DRAW:
+			g.endGame(connect4.GameOver_ENDED_BY_OPERATOR, -1, message+" It's a draw.", message+" It's a draw.")
+		case connect4.EndGameRequest_WIN:
+			winner := -1
+			for seat, player := range g.players {
+				if player != nil && strings.EqualFold(player.Nickname, req.Winner) {
+					winner = seat
+				}
+			}
+			if winner < 0 {
+				err = status.Errorf(codes.InvalidArgument, "%q is not playing game %s", req.Winner, g.id)
+				return
+			}
+			g.currentPlayer = winner
+			g.endGame(connect4.GameOver_ENDED_BY_OPERATOR, winner, message+" You won!", message+" You lost.")
+		default:
+			err = status.Errorf(codes.InvalidArgument, "unknown outcome %v", req.Outcome)
+			return
+		}
+
+		empty = g.isEmpty()
+	})
+	switch {
+	case !ended:
+		return nil, status.Errorf(codes.NotFound, "game %s not found", req.GameId)
+	case err != nil:
+		return nil, err
+	}
+
+	if empty {
+		a.s.removeGame(g)
+	}
+	return &connect4.AdminResponse{Message: fmt.Sprintf("Game %s ended (%s).", g.id, metricLabel(req.Outcome.String()))}, nil
+}
+
+func (a *adminServer) KickPlayer(ctx context.Context, req *connect4.KickPlayerRequest) (*connect4.AdminResponse, error) {
+	kicked := a.s.kick(req.Nickname, kickMessage("You were disconnected by an operator", req.Reason))
+	if kicked == 0 {
+		return nil, status.Errorf(codes.NotFound, "%s is not connected", req.Nickname)
+	}
+	return &connect4.AdminResponse{Message: fmt.Sprintf("Disconnected %d session(s) of %s.", kicked, req.Nickname)}, nil
+}
+
+func (a *adminServer) BanPlayer(ctx context.Context, req *connect4.BanPlayerRequest) (*connect4.AdminResponse, error) {
+	nickname, err := cleanNickname(req.Nickname)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	req.Nickname = nickname
+	if a.admins[accountKey(req.Nickname)] {
+		return nil, status.Errorf(codes.InvalidArgument, "%s is an admin and can't be banned", req.Nickname)
+	}
+	if req.DurationSeconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "ban duration must not be negative")
+	}
+
+	admin, _ := playerFromContext(ctx)
+	ban := Ban{Nickname: req.Nickname, Reason: req.Reason, BannedBy: admin, BannedAt: time.Now()}
+	if req.DurationSeconds > 0 {
+		ban.ExpiresAt = ban.BannedAt.Add(time.Duration(req.DurationSeconds) * time.Second)
+	}
+	if err := a.s.bans.Ban(ban); err != nil {
+		return nil, status.Errorf(codes.Internal, "saving the ban: %v", err)
+	}
+
+	kicked := a.s.kick(req.Nickname, kickMessage("You were banned by an operator", req.Reason))
+	return &connect4.AdminResponse{Message: fmt.Sprintf("Banned %s and disconnected %d session(s).", req.Nickname, kicked)}, nil
+}
+
+func (a *adminServer) UnbanPlayer(ctx context.Context, req *connect4.UnbanPlayerRequest) (*connect4.AdminResponse, error) {
+	unbanned, err := a.s.bans.Unban(req.Nickname)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "saving the bans: %v", err)
+	}
+	if !unbanned {
+		return nil, status.Errorf(codes.NotFound, "%s is not banned", req.Nickname)
+	}
+	return &connect4.AdminResponse{Message: "Unbanned " + req.Nickname + "."}, nil
+}
+
+func (a *adminServer) ListBans(ctx context.Context, req *connect4.ListBansRequest) (*connect4.BanList, error) {
+	list := &connect4.BanList{}
+	for _, ban := range a.s.bans.List() {
+		entry := &connect4.Ban{Nickname: ban.Nickname, Reason: ban.Reason, BannedBy: ban.BannedBy, BannedAt: ban.BannedAt.Unix()}
+		if !ban.ExpiresAt.IsZero() {
+			entry.ExpiresAt = ban.ExpiresAt.Unix()
+		}
+		list.Bans = append(list.Bans, entry)
+	}
+	return list, nil
+}
+
+func (a *adminServer) Announce(ctx context.Context, req *connect4.AnnounceRequest) (*connect4.AdminResponse, error) {
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		return nil, status.Error(codes.InvalidArgument, "the announcement is empty")
+	}
+
+	update := &connect4.GameUpdate{
+		Message: "Announcement: " + text,
+		Event:   &connect4.GameUpdate_Announcement{Announcement: &connect4.Announcement{Text: text}},
+	}
+
+	reached := 0
+	for _, g := range a.s.sortedGames() {
+		g.do(func() {
+			for _, client := range append(g.players[:], g.spectators...) {
+				if client != nil && client.Stream != nil {
+					client.send(update)
+					reached++
+				}
+			}
+		})
+	}
+	return &connect4.AdminResponse{Message: fmt.Sprintf("Announcement sent to %d client(s).", reached)}, nil
+}
+
+func (a *adminServer) SetMaintenance(ctx context.Context, req *connect4.SetMaintenanceRequest) (*connect4.MaintenanceStatus, error) {
+	a.s.gamesLock.Lock()
+	defer a.s.gamesLock.Unlock()
+
+	a.s.maintenance = req.Enabled
+	a.s.maintenanceMessage = req.Message
+	return &connect4.MaintenanceStatus{Enabled: a.s.maintenance, Message: a.s.maintenanceMessage}, nil
+}
+
+// sortedGames returns the games on the server, oldest first.
+func (s *server) sortedGames() []*game {
+	s.gamesLock.Lock()
+	games := make([]*game, 0, len(s.games))
+	for _, g := range s.games {
+		games = append(games, g)
+	}
+	s.gamesLock.Unlock()
+
+	sort.Slice(games, func(i, j int) bool { return games[i].createdAt.Before(games[j].createdAt) })
+	return games
+}
+
+func (s *server) findGame(gameID string) (*game, error) {
+	s.gamesLock.Lock()
+	defer s.gamesLock.Unlock()
+
+	g := s.games[gameID]
+	if g == nil {
+		return nil, status.Errorf(codes.NotFound, "game %s not found", gameID)
+	}
+	return g, nil
+}
+
+// kick ends every session of the nickname with message, returning how many
+// there were.
+func (s *server) kick(nickname string, message string) int {
+	kicked := 0
+	for _, g := range s.sortedGames() {
+		g.do(func() {
+			for _, client := range append(g.players[:], g.spectators...) {
+				if client != nil && client.Stream != nil && accountKey(client.Nickname) == accountKey(nickname) && client.disconnect(message) {
+					kicked++
+				}
+			}
+		})
+	}
+	return kicked
+}
+
+func kickMessage(message string, reason string) string {
+	if reason != "" {
+		return message + ": " + reason + "."
+	}
+	return message + "."
+}
+
+// connectedPlayer describes the client for the Admin service. It must run
+// on the game's goroutine.
+func (c *ClientInfo) connectedPlayer(g *game) *connect4.ConnectedPlayer {
+	player := &connect4.ConnectedPlayer{
+		Nickname:      c.Nickname,
+		GameId:        g.id,
+		Ip:            c.IP,
+		Authenticated: c.Authenticated,
+		Spectator:     c.Spectator,
+		Connected:     c.Stream != nil,
+	}
+	if c.Stream != nil {
+		player.Transport = streamTransport(c.Stream)
+	}
+	return player
+}
+
+// auditLog records the calls to the Admin service, one JSON object per
+// line, in a file that is only appended to.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File // Nil when the calls are only logged
+}
+
+type auditEntry struct {
+	Time    time.Time       `json:"time"`
+	Admin   string          `json:"admin"`
+	IP      string          `json:"ip,omitempty"`
+	Method  string          `json:"method"`
+	Request json.RawMessage `json:"request"`
+	Code    string          `json:"code"`
+	Error   string          `json:"error,omitempty"`
+}
+
+func newAuditLog(path string) (*auditLog, error) {
+	if path == "" {
+		return &auditLog{}, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return &auditLog{file: file}, nil
+}
+
+// record writes a call to the Admin service to the log of the server and to
+// the audit log.
+func (l *auditLog) record(ctx context.Context, admin string, method string, req any, err error) {
+	entry := auditEntry{Time: time.Now().UTC(), Admin: admin, Method: method, Request: json.RawMessage("{}"), Code: status.Code(err).String()}
+	if p, ok := peer.FromContext(ctx); ok {
+		entry.IP = p.Addr.String()
+	}
+	if message, ok := req.(proto.Message); ok {
+		if data, err := protojson.Marshal(message); err == nil {
+			entry.Request = data
+		}
+	}
+	if err != nil {
+		entry.Error = status.Convert(err).Message()
+	}
+
+	slog.InfoContext(ctx, "admin action", "admin", admin, "action", method, "request", string(entry.Request), "code", entry.Code)
+
+	if l.file == nil {
+		return
+	}
+	data, _ := json.Marshal(entry)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		slog.Error("failed to write the audit log", "err", err)
+	}
+}
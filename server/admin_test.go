@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminNicknamesCantBeRegistered(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.accounts.Register("alice", "secret123"); err != nil {
+		t.Fatal(err)
+	}
+	// root is an admin without an account, which only a client certificate
+	// can claim
+	admin := newAdminServer(s, []string{"alice", "root"}, &auditLog{})
+	conn := serveTestServer(t, s, admin)
+	client := connect4.NewConnect4GameClient(conn)
+	ctx := context.Background()
+
+	for _, nickname := range []string{"root", "Root", "ｒｏｏｔ"} {
+		_, err := client.Register(ctx, &connect4.RegisterRequest{Nickname: nickname, Password: "guessed123"})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("registering %q: got %v, want %v", nickname, err, codes.PermissionDenied)
+		}
+	}
+
+	// Had a registration gone through, the guest would now be an admin
+	login, err := client.Login(ctx, &connect4.LoginRequest{Nickname: "root", Password: "guessed123"})
+	if err == nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+login.Token)
+		_, err = connect4.NewAdminClient(conn).ListPlayers(ctx, &connect4.ListPlayersRequest{})
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("calling Admin as the guest: got %v, want %v", err, codes.Unauthenticated)
+	}
+}
+
+func TestAdminCanCallAdminService(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.accounts.Register("alice", "secret123"); err != nil {
+		t.Fatal(err)
+	}
+	conn := serveTestServer(t, s, newAdminServer(s, []string{"Alice"}, &auditLog{}))
+	ctx := context.Background()
+
+	login, err := connect4.NewConnect4GameClient(conn).Login(ctx, &connect4.LoginRequest{Nickname: "alice", Password: "secret123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+login.Token)
+	if _, err := connect4.NewAdminClient(conn).ListPlayers(ctx, &connect4.ListPlayersRequest{}); err != nil {
+		t.Errorf("calling Admin as an admin: %v", err)
+	}
+}
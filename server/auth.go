@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/text/unicode/norm"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	minPasswordLength = 6
+	maxNicknameLength = 20
+)
+
+var (
+	errAccountExists   = errors.New("nickname is already registered")
+	errInvalidLogin    = errors.New("invalid nickname or password")
+	errInvalidToken    = errors.New("invalid session token")
+	errExpiredToken    = errors.New("session token has expired")
+	errNicknameInvalid = fmt.Errorf("nickname must have between 1 and %d characters", maxNicknameLength)
+	errNicknameRunes   = errors.New("nickname must only have printable characters")
+)
+
+// Account is a registered player. Only the bcrypt hash of the password is kept.
+type Account struct {
+	Nickname     string    `json:"nickname"`
+	PasswordHash []byte    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// accountStore keeps the registered accounts in memory and, when a path is
+// set, persists them as a JSON file so they survive a restart.
+type accountStore struct {
+	mu       sync.Mutex
+	path     string
+	accounts map[string]Account // Indexed by accountKey
+}
+
+func newAccountStore(path string) (*accountStore, error) {
+	store := &accountStore{path: path, accounts: make(map[string]Account)}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading accounts file: %w", err)
+	}
+
+	var accounts []Account
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("parsing accounts file: %w", err)
+	}
+	for _, account := range accounts {
+		store.accounts[accountKey(account.Nickname)] = account
+	}
+	return store, nil
+}
+
+// Register creates a new account, failing if the nickname is already taken.
+func (a *accountStore) Register(nickname, password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must have at least %d characters", minPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, exists := a.accounts[accountKey(nickname)]; exists {
+		return errAccountExists
+	}
+	a.accounts[accountKey(nickname)] = Account{Nickname: nickname, PasswordHash: hash, CreatedAt: time.Now()}
+
+	return a.save()
+}
+
+// Authenticate checks the password of an account and returns its nickname
+// with the casing used when it was registered.
+func (a *accountStore) Authenticate(nickname, password string) (string, error) {
+	a.mu.Lock()
+	account, exists := a.accounts[accountKey(nickname)]
+	a.mu.Unlock()
+
+	if !exists {
+		return "", errInvalidLogin
+	}
+	if err := bcrypt.CompareHashAndPassword(account.PasswordHash, []byte(password)); err != nil {
+		return "", errInvalidLogin
+	}
+	return account.Nickname, nil
+}
+
+// IsRegistered reports whether the nickname belongs to an account.
+func (a *accountStore) IsRegistered(nickname string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, exists := a.accounts[accountKey(nickname)]
+	return exists
+}
+
+// Lookup returns the account the nickname belongs to, if any.
+func (a *accountStore) Lookup(nickname string) (Account, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	account, exists := a.accounts[accountKey(nickname)]
+	return account, exists
+}
+
+// save writes the accounts file. The caller must hold a.mu.
+func (a *accountStore) save() error {
+	if a.path == "" {
+		return nil
+	}
+
+	accounts := make([]Account, 0, len(a.accounts))
+	for _, account := range a.accounts {
+		accounts = append(accounts, account)
+	}
+
+	data, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated file behind
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.path)
+}
+
+// accountKey is the form of a nickname its account is found by, so names
+// that only differ in casing or in how the same characters are encoded,
+// like "Alice" and a full-width "ａｌｉｃｅ", can't be told apart.
+func accountKey(nickname string) string {
+	return strings.ToLower(norm.NFKC.String(strings.TrimSpace(nickname)))
+}
+
+// cleanNickname trims the spaces around a nickname, and checks that the rest
+// is short enough and only has printable characters. Control and format
+// characters, like ANSI escapes and zero-width spaces, would let a player
+// pass for another.
+func cleanNickname(nickname string) (string, error) {
+	nickname = strings.TrimSpace(nickname)
+	if nickname == "" || utf8.RuneCountInString(nickname) > maxNicknameLength {
+		return "", errNicknameInvalid
+	}
+	for _, r := range nickname {
+		if !unicode.IsPrint(r) || r == utf8.RuneError {
+			return "", errNicknameRunes
+		}
+	}
+	return nickname, nil
+}
+
+// tokenClaims is the payload of a session token.
+type tokenClaims struct {
+	Nickname  string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// tokenSigner issues and verifies session tokens of the form
+// base64(claims) + "." + base64(HMAC-SHA256(claims)).
+type tokenSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func newTokenSigner(secret []byte, ttl time.Duration) (*tokenSigner, error) {
+	if len(secret) == 0 {
+		// Without a configured secret, tokens are only valid until the server restarts
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return &tokenSigner{secret: secret, ttl: ttl}, nil
+}
+
+// Issue returns a token for the nickname and the time it expires.
+func (t *tokenSigner) Issue(nickname string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(t.ttl)
+
+	payload, err := json.Marshal(tokenClaims{Nickname: nickname, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + t.sign(encoded), expiresAt, nil
+}
+
+// Verify checks the signature and expiration of a token and returns the
+// nickname it was issued to.
+func (t *tokenSigner) Verify(token string) (string, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(t.sign(encoded))) {
+		return "", errInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errInvalidToken
+	}
+
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errInvalidToken
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return "", errExpiredToken
+	}
+	return claims.Nickname, nil
+}
+
+func (t *tokenSigner) sign(encoded string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Register creates a new account.
+func (s *server) Register(ctx context.Context, req *connect4.RegisterRequest) (*connect4.RegisterResponse, error) {
+	nickname, err := cleanNickname(req.Nickname)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if s.reservedNicknames[accountKey(nickname)] {
+		return nil, status.Errorf(codes.PermissionDenied, "the nickname %s is reserved", nickname)
+	}
+
+	err = s.accounts.Register(nickname, req.Password)
+	switch {
+	case errors.Is(err, errAccountExists):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &connect4.RegisterResponse{Message: "Account " + nickname + " registered."}, nil
+}
+
+// Login exchanges valid credentials for a session token.
+func (s *server) Login(ctx context.Context, req *connect4.LoginRequest) (*connect4.LoginResponse, error) {
+	nickname, err := s.accounts.Authenticate(req.Nickname, req.Password)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err := s.bans.Check(nickname); err != nil {
+		return nil, err
+	}
+
+	token, expiresAt, err := s.tokens.Issue(nickname)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to issue session token")
+	}
+
+	return &connect4.LoginResponse{Token: token, ExpiresAt: expiresAt.Unix()}, nil
+}
+
+type playerContextKey struct{}
+
+// playerFromContext returns the nickname of the authenticated player, if any.
+func playerFromContext(ctx context.Context) (string, bool) {
+	nickname, ok := ctx.Value(playerContextKey{}).(string)
+	return nickname, ok
+}
+
+// authenticate attaches the player identified by the session token in the
+// request metadata, or else by the verified client certificate, to the
+// context. Requests with neither are let through as guests; requests with a
+// bad token, or a certificate whose name isn't a valid nickname, are
+// rejected.
+func (s *server) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		if commonName, ok := playerFromCertificate(ctx); ok {
+			nickname, err := cleanNickname(commonName)
+			if err != nil {
+				return nil, status.Errorf(codes.Unauthenticated, "the name of the client certificate can't be used: %v", err)
+			}
+			if err := s.bans.Check(nickname); err != nil {
+				return nil, err
+			}
+			return withPlayer(ctx, nickname), nil
+		}
+		return ctx, nil
+	}
+
+	token, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found {
+		return nil, status.Error(codes.Unauthenticated, "authorization metadata must use the Bearer scheme")
+	}
+
+	nickname, err := s.tokens.Verify(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err := s.bans.Check(nickname); err != nil {
+		return nil, err // Tokens issued before the ban stop working too
+	}
+	return withPlayer(ctx, nickname), nil
+}
+
+// unaryAuthInterceptor authenticates every unary RPC but Register and Login.
+func (s *server) unaryAuthInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if info.FullMethod == connect4.Connect4Game_Register_FullMethodName || info.FullMethod == connect4.Connect4Game_Login_FullMethodName {
+		return handler(ctx, req)
+	}
+
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamAuthInterceptor authenticates every streaming RPC.
+func (s *server) streamAuthInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextStream overrides the context of a stream so handlers can retrieve
+// the authenticated player and the request being logged from it.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (c *contextStream) Context() context.Context {
+	return c.ctx
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenSigner(t *testing.T) {
+	signer, err := newTokenSigner([]byte("0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, expiresAt, err := signer.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(expiresAt); until <= 59*time.Minute || until > time.Hour {
+		t.Errorf("token expires in %v, want an hour", until)
+	}
+
+	nickname, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("verifying a token just issued: %v", err)
+	}
+	if nickname != "alice" {
+		t.Errorf("token issued to %q, want alice", nickname)
+	}
+}
+
+func TestTokenSignerRejectsInvalidTokens(t *testing.T) {
+	signer, err := newTokenSigner([]byte("0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := signer.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newTokenSigner([]byte("fedcba9876543210"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _, err := other.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, _, err := signer.Issue("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _, _ := strings.Cut(token, ".")
+	_, signature, _ := strings.Cut(bob, ".")
+
+	tests := map[string]string{
+		"empty":                 "",
+		"no signature":          claims,
+		"other secret":          forged,
+		"swapped signature":     claims + "." + signature,
+		"truncated signature":   token[:len(token)-1],
+		"signed garbage claims": "%%%." + signer.sign("%%%"),
+		"signed invalid json":   "bm90IGpzb24." + signer.sign("bm90IGpzb24"),
+	}
+	for name, token := range tests {
+		if _, err := signer.Verify(token); !errors.Is(err, errInvalidToken) {
+			t.Errorf("%s: got %v, want %v", name, err, errInvalidToken)
+		}
+	}
+}
+
+func TestTokenSignerRejectsExpiredTokens(t *testing.T) {
+	signer, err := newTokenSigner([]byte("0123456789abcdef"), -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := signer.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Verify(token); !errors.Is(err, errExpiredToken) {
+		t.Errorf("got %v, want %v", err, errExpiredToken)
+	}
+}
+
+func TestTokenSignerWithoutSecret(t *testing.T) {
+	// Each server without a configured secret draws its own, so the tokens
+	// of one aren't accepted by another
+	first, err := newTokenSigner(nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newTokenSigner(nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := first.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Verify(token); err != nil {
+		t.Errorf("verifying with the same signer: %v", err)
+	}
+	if _, err := second.Verify(token); !errors.Is(err, errInvalidToken) {
+		t.Errorf("verifying with another signer: got %v, want %v", err, errInvalidToken)
+	}
+}
+
+func TestCleanNickname(t *testing.T) {
+	valid := map[string]string{
+		"alice":                        "alice",
+		"  alice ":                     "alice",
+		"Mary Jane":                    "Mary Jane",
+		"joão":                         "joão",
+		"名前":                           "名前",
+		strings.Repeat("é", 20):        strings.Repeat("é", 20), // Runes are counted, not bytes
+		"\talice\n":                    "alice",
+		"x_" + strings.Repeat("o", 18): "x_" + strings.Repeat("o", 18),
+	}
+	for nickname, want := range valid {
+		got, err := cleanNickname(nickname)
+		if err != nil || got != want {
+			t.Errorf("%q: got %q, %v, want %q", nickname, got, err, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"   ",
+		strings.Repeat("a", 21),
+		"alice\u200b",    // Zero-width space
+		"\u202ealice",    // Right-to-left override
+		"al\x1b[31mice",  // ANSI escape
+		"ali\nce",        // Control character
+		"alice\u00a0bob", // No-break space
+		"alice\xff",      // Invalid UTF-8
+	}
+	for _, nickname := range invalid {
+		if got, err := cleanNickname(nickname); err == nil {
+			t.Errorf("%q: accepted as %q", nickname, got)
+		}
+	}
+}
+
+func TestAccountKey(t *testing.T) {
+	same := []string{"alice", "Alice", "ALICE", " alice ", "ａｌｉｃｅ"}
+	for _, nickname := range same {
+		if accountKey(nickname) != accountKey("alice") {
+			t.Errorf("%q has key %q, want the key of alice %q", nickname, accountKey(nickname), accountKey("alice"))
+		}
+	}
+	if accountKey("alice") == accountKey("alicia") {
+		t.Error("different nicknames have the same key")
+	}
+}
+
+func TestRegisteredNicknameCantBeImitated(t *testing.T) {
+	accounts, err := newAccountStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.Register("alice", "secret123"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, nickname := range []string{"Alice", " alice", "ａｌｉｃｅ"} {
+		if !accounts.IsRegistered(nickname) {
+			t.Errorf("%q isn't seen as the registered alice", nickname)
+		}
+	}
+	if err := accounts.Register("ａｌｉｃｅ", "secret123"); !errors.Is(err, errAccountExists) {
+		t.Errorf("registering a full-width alice: got %v, want %v", err, errAccountExists)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Ban keeps a nickname from logging in or playing, until it expires.
+type Ban struct {
+	Nickname  string    `json:"nickname"`
+	Reason    string    `json:"reason"`
+	BannedBy  string    `json:"banned_by"`
+	BannedAt  time.Time `json:"banned_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // Zero for a permanent ban
+}
+
+func (b Ban) expired(now time.Time) bool {
+	return !b.ExpiresAt.IsZero() && now.After(b.ExpiresAt)
+}
+
+// banStore keeps the bans in memory and, when a path is set, persists them
+// as a JSON file, like accountStore.
+type banStore struct {
+	mu   sync.Mutex
+	path string
+	bans map[string]Ban // Indexed by lower-cased nickname
+}
+
+func newBanStore(path string) (*banStore, error) {
+	store := &banStore{path: path, bans: make(map[string]Ban)}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading bans file: %w", err)
+	}
+
+	var bans []Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, fmt.Errorf("parsing bans file: %w", err)
+	}
+	for _, ban := range bans {
+		store.bans[accountKey(ban.Nickname)] = ban
+	}
+	return store, nil
+}
+
+// Ban adds or replaces the ban of a nickname.
+func (b *banStore) Ban(ban Ban) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bans[accountKey(ban.Nickname)] = ban
+	return b.save()
+}
+
+// Unban lifts the ban of a nickname, reporting whether it was banned.
+func (b *banStore) Unban(nickname string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ban, exists := b.bans[accountKey(nickname)]
+	if !exists || ban.expired(time.Now()) {
+		return false, nil
+	}
+	delete(b.bans, accountKey(nickname))
+	return true, b.save()
+}
+
+// Check returns a PermissionDenied error if the nickname is banned.
+func (b *banStore) Check(nickname string) error {
+	b.mu.Lock()
+	ban, exists := b.bans[accountKey(nickname)]
+	b.mu.Unlock()
+
+	if !exists || ban.expired(time.Now()) {
+		return nil
+	}
+
+	message := "the nickname " + ban.Nickname + " is banned"
+	if !ban.ExpiresAt.IsZero() {
+		message += " until " + ban.ExpiresAt.UTC().Format(time.RFC1123)
+	}
+	if ban.Reason != "" {
+		message += ": " + ban.Reason
+	}
+	return status.Error(codes.PermissionDenied, message)
+}
+
+// List returns the bans in effect, oldest first.
+func (b *banStore) List() []Ban {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(b.bans))
+	for _, ban := range b.bans {
+		if !ban.expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].BannedAt.Before(bans[j].BannedAt) })
+	return bans
+}
+
+// save writes the bans file, leaving the expired bans out. The caller must
+// hold b.mu.
+func (b *banStore) save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(b.bans))
+	for _, ban := range b.bans {
+		if !ban.expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+)
+
+const (
+	chatHistorySize = 50               // Messages kept per game and delivered to players who join or come back
+	chatBurst       = 5                // Messages a client can send within chatWindow
+	chatWindow      = 10 * time.Second // Period of the chat rate limit
+)
+
+// emotes maps the names accepted by the "emote" command to their text.
+var emotes = map[string]string{
+	"gg":       "Good game!",
+	"glhf":     "Good luck, have fun!",
+	"wave":     "👋",
+	"thumbsup": "👍",
+	"wow":      "Wow!",
+	"oops":     "Oops!",
+	"thinking": "🤔",
+}
+
+// chatFilter rewrites the text of a chat message before it is delivered,
+// e.g. to mask profanity.
+type chatFilter func(text string) string
+
+// maskWords returns a filter that replaces the given words, ignoring case,
+// with asterisks.
+func maskWords(words []string) chatFilter {
+	if len(words) == 0 {
+		return func(text string) string { return text }
+	}
+
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	pattern := regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+
+	return func(text string) string {
+		return pattern.ReplaceAllStringFunc(text, func(word string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(word))
+		})
+	}
+}
+
+// handleChatCommand validates a chat message or emote and posts it to the
+// channel of the sender.
+func (s *server) handleChatCommand(current *session, in *connect4.GameCommand, stream connect4.Connect4Game_GameSessionServer) {
+	message := &connect4.ChatMessage{From: current.client.Nickname}
+	if current.client.Spectator {
+		message.Channel = connect4.ChatMessage_SPECTATORS
+	}
+
+	if in.Command == "emote" {
+		text, ok := emotes[in.Text]
+		if !ok {
+			stream.Send(&connect4.GameUpdate{Message: "Unknown emote " + in.Text + ". Try: " + emoteNames() + "."})
+			return
+		}
+		message.Emote = in.Text
+		message.Text = text
+	} else {
+		text := strings.TrimSpace(in.Text)
+		switch {
+		case text == "":
+			return
+		case utf8.RuneCountInString(text) > s.chatMaxLength:
+			stream.Send(&connect4.GameUpdate{Message: fmt.Sprintf("Your message is too long, the limit is %d characters.", s.chatMaxLength)})
+			return
+		}
+		message.Text = s.chatFilter(text)
+	}
+
+	current.game.postChat(current.client, message)
+}
+
+// postChat delivers a chat message to whoever can read its channel. Players
+// only read the players' channel, while spectators read both.
+func (g *game) postChat(sender *ClientInfo, message *connect4.ChatMessage) {
+	g.do(func() {
+		if !sender.allowChat(time.Now()) {
+			sender.send(&connect4.GameUpdate{Message: "You are sending messages too fast, slow down."})
+			return
+		}
+
+		message.SentAt = time.Now().UnixMilli()
+		g.chatHistory = append(g.chatHistory, message)
+		if len(g.chatHistory) > chatHistorySize {
+			g.chatHistory = g.chatHistory[len(g.chatHistory)-chatHistorySize:]
+		}
+
+		update := &connect4.GameUpdate{Event: &connect4.GameUpdate_Chat{Chat: message}}
+		if message.Channel == connect4.ChatMessage_PLAYERS {
+			for seat := range g.players {
+				g.send(seat, update)
+			}
+		}
+		g.watch(update)
+	})
+}
+
+// sendChatHistory sends the recent messages the client can read, if any. It
+// must run on the game's goroutine.
+func (g *game) sendChatHistory(client *ClientInfo) {
+	history := &connect4.ChatHistory{}
+	for _, message := range g.chatHistory {
+		if client.Spectator || message.Channel == connect4.ChatMessage_PLAYERS {
+			history.Messages = append(history.Messages, message)
+		}
+	}
+
+	if len(history.Messages) > 0 && client.Stream != nil {
+		client.send(&connect4.GameUpdate{Event: &connect4.GameUpdate_ChatHistory{ChatHistory: history}})
+	}
+}
+
+// allowChat reports whether the client can send another message at now,
+// recording it if so. It must run on the goroutine of the client's game.
+func (c *ClientInfo) allowChat(now time.Time) bool {
+	recent := c.chatSent[:0]
+	for _, sent := range c.chatSent {
+		if now.Sub(sent) < chatWindow {
+			recent = append(recent, sent)
+		}
+	}
+	c.chatSent = recent
+
+	if len(c.chatSent) >= chatBurst {
+		return false
+	}
+	c.chatSent = append(c.chatSent, now)
+	return true
+}
+
+func emoteNames() string {
+	names := make([]string, 0, len(emotes))
+	for name := range emotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
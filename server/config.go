@@ -0,0 +1,475 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the server. Values are resolved in this
+// order, each one overriding the previous: defaults, the YAML config file,
+// CONNECT4_* environment variables and command-line flags.
+type Config struct {
+	ListenAddr  string `yaml:"listen_addr"`
+	StoragePath string `yaml:"storage_path"` // Directory where accounts are persisted
+	LogLevel    string `yaml:"log_level"`
+	LogFormat   string `yaml:"log_format"` // text or json
+	Reflection  bool   `yaml:"reflection"` // gRPC server reflection, for tools like grpcurl
+
+	MaxGames       int           `yaml:"max_games"`       // 0 for no limit
+	ReconnectGrace time.Duration `yaml:"reconnect_grace"` // 0 gives the win to the opponent right away
+	ShutdownDrain  time.Duration `yaml:"shutdown_drain"`  // Time games in progress have to finish on shutdown before they are saved
+
+	HTTP    HTTPConfig    `yaml:"http"`
+	Metrics MetricsConfig `yaml:"metrics"`
+	Telnet  TelnetConfig  `yaml:"telnet"`
+	Tracing TracingConfig `yaml:"tracing"`
+	TLS     TLSConfig     `yaml:"tls"`
+	Auth    AuthConfig    `yaml:"auth"`
+	Admin   AdminConfig   `yaml:"admin"`
+	Limits  LimitsConfig  `yaml:"limits"`
+	Streams StreamsConfig `yaml:"streams"`
+	Chat    ChatConfig    `yaml:"chat"`
+}
+
+type HTTPConfig struct {
+	ListenAddr     string   `yaml:"listen_addr"`     // Empty disables the HTTP server
+	AllowedOrigins []string `yaml:"allowed_origins"` // Web pages allowed to open WebSocket sessions, "*" for any
+}
+
+// MetricsConfig sets where the Prometheus metrics are served. They aren't
+// authenticated, so by default only a local listener serves them.
+type MetricsConfig struct {
+	ListenAddr string `yaml:"listen_addr"` // Empty disables the metrics server
+	Public     bool   `yaml:"public"`      // Also serve /metrics on the HTTP server
+}
+
+type TelnetConfig struct {
+	ListenAddr string `yaml:"listen_addr"` // Empty disables the telnet frontend
+}
+
+type TracingConfig struct {
+	Exporter string `yaml:"exporter"` // none, stdout or otlp
+	Endpoint string `yaml:"endpoint"` // host:port of the OTLP gRPC collector, empty for the OTEL_EXPORTER_OTLP_* variables
+	Insecure bool   `yaml:"insecure"` // Send to the collector without TLS
+}
+
+type TLSConfig struct {
+	Cert              string `yaml:"cert"`
+	Key               string `yaml:"key"`
+	ClientCA          string `yaml:"client_ca"`
+	RequireClientCert bool   `yaml:"require_client_cert"`
+}
+
+type AuthConfig struct {
+	TokenSecret string        `yaml:"token_secret"` // Random per process when empty
+	TokenTTL    time.Duration `yaml:"token_ttl"`
+}
+
+type AdminConfig struct {
+	Players []string `yaml:"players"` // Accounts allowed to call the Admin service
+}
+
+// LimitsConfig protects the server from abusive clients. A rate of 0
+// disables its limit.
+type LimitsConfig struct {
+	CommandRate         int           `yaml:"command_rate"`           // Commands per second of a session
+	CommandBurst        int           `yaml:"command_burst"`          // Commands a session can send at once
+	PlayerCommandRate   int           `yaml:"player_command_rate"`    // Commands per second of a player, across sessions
+	PlayerCommandBurst  int           `yaml:"player_command_burst"`   // Commands a player can send at once
+	RPCRate             int           `yaml:"rpc_rate"`               // Unary RPCs and REST requests per second of an address
+	RPCBurst            int           `yaml:"rpc_burst"`              // Unary RPCs an address can make at once
+	MaxConnectionsPerIP int           `yaml:"max_connections_per_ip"` // Open sessions of an address, 0 for no limit
+	MaxMessageSize      int           `yaml:"max_message_size"`       // Bytes of a gRPC message, WebSocket command or REST body
+	MaxViolations       int           `yaml:"max_violations"`         // Violations within ViolationWindow that ban an address, 0 to never ban
+	ViolationWindow     time.Duration `yaml:"violation_window"`
+	BanDuration         time.Duration `yaml:"ban_duration"`
+}
+
+// StreamsConfig sets how the server copes with clients that don't read the
+// updates as fast as they are sent.
+type StreamsConfig struct {
+	SendQueueSize   int `yaml:"send_queue_size"`   // Updates waiting to be written to a session
+	SlowPlayerDrops int `yaml:"slow_player_drops"` // Updates a player can miss in a row before it is disconnected
+
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"` // Between the pings sent to each client
+	HeartbeatTimeout  time.Duration `yaml:"heartbeat_timeout"`  // Silence after which a client is considered gone
+}
+
+type ChatConfig struct {
+	MaxLength    int      `yaml:"max_length"`    // Characters per message
+	BlockedWords []string `yaml:"blocked_words"` // Masked with asterisks in every message
+}
+
+func defaultConfig() Config {
+	return Config{
+		ListenAddr:  ":50051",
+		StoragePath: ".",
+		LogLevel:    "info",
+		LogFormat:   "text",
+		Reflection:  true,
+
+		ReconnectGrace: 30 * time.Second,
+		ShutdownDrain:  30 * time.Second,
+
+		HTTP:    HTTPConfig{ListenAddr: "localhost:8080"},
+		Metrics: MetricsConfig{ListenAddr: "localhost:9090"},
+		Tracing: TracingConfig{Exporter: "none"},
+
+		Auth: AuthConfig{TokenTTL: 24 * time.Hour},
+		Limits: LimitsConfig{
+			CommandRate:         10,
+			CommandBurst:        20,
+			PlayerCommandRate:   20,
+			PlayerCommandBurst:  40,
+			RPCRate:             10,
+			RPCBurst:            30,
+			MaxConnectionsPerIP: 20,
+			MaxMessageSize:      16 << 10,
+			MaxViolations:       20,
+			ViolationWindow:     time.Minute,
+			BanDuration:         10 * time.Minute,
+		},
+		Streams: StreamsConfig{
+			SendQueueSize:   64,
+			SlowPlayerDrops: 8,
+
+			HeartbeatInterval: 15 * time.Second,
+			HeartbeatTimeout:  45 * time.Second,
+		},
+		Chat: ChatConfig{MaxLength: 200},
+	}
+}
+
+// configOption binds a setting to its flag and environment variable.
+type configOption struct {
+	flag  string
+	env   string
+	usage string
+	field func(c *Config) any // Pointer to the field the option sets
+}
+
+var configOptions = []configOption{
+	{"listen", "CONNECT4_LISTEN", "address the gRPC server listens on", func(c *Config) any { return &c.ListenAddr }},
+	{"storage-path", "CONNECT4_STORAGE_PATH", "directory where accounts are persisted", func(c *Config) any { return &c.StoragePath }},
+	{"log-level", "CONNECT4_LOG_LEVEL", "minimum log level: debug, info, warn or error", func(c *Config) any { return &c.LogLevel }},
+	{"log-format", "CONNECT4_LOG_FORMAT", "format of the logs: text or json", func(c *Config) any { return &c.LogFormat }},
+	{"reflection", "CONNECT4_REFLECTION", "register the gRPC reflection service (disable with -reflection=false)", func(c *Config) any { return &c.Reflection }},
+	{"max-games", "CONNECT4_MAX_GAMES", "maximum number of concurrent games, 0 for no limit", func(c *Config) any { return &c.MaxGames }},
+	{"reconnect-grace", "CONNECT4_RECONNECT_GRACE", "how long a logged in player that disconnects has to come back to a game", func(c *Config) any { return &c.ReconnectGrace }},
+	{"shutdown-drain", "CONNECT4_SHUTDOWN_DRAIN", "time games in progress have to finish on SIGINT or SIGTERM before they are saved", func(c *Config) any { return &c.ShutdownDrain }},
+	{"http-listen", "CONNECT4_HTTP_LISTEN", "address the HTTP server (WebSocket gateway, web client and REST API) listens on, empty to disable it", func(c *Config) any { return &c.HTTP.ListenAddr }},
+	{"http-allowed-origins", "CONNECT4_HTTP_ALLOWED_ORIGINS", "comma-separated origins of the web pages allowed to open WebSocket sessions (\"*\" for any)", func(c *Config) any { return &c.HTTP.AllowedOrigins }},
+	{"metrics-listen", "CONNECT4_METRICS_LISTEN", "address the Prometheus metrics are served on, empty to disable it", func(c *Config) any { return &c.Metrics.ListenAddr }},
+	{"metrics-public", "CONNECT4_METRICS_PUBLIC", "also serve the metrics, unauthenticated, at /metrics of the HTTP server", func(c *Config) any { return &c.Metrics.Public }},
+	{"telnet-listen", "CONNECT4_TELNET_LISTEN", "address the plain text (telnet) frontend listens on, empty to disable it", func(c *Config) any { return &c.Telnet.ListenAddr }},
+	{"tracing-exporter", "CONNECT4_TRACING_EXPORTER", "where OpenTelemetry traces are sent: none, stdout or otlp", func(c *Config) any { return &c.Tracing.Exporter }},
+	{"tracing-endpoint", "CONNECT4_TRACING_ENDPOINT", "host:port of the OTLP gRPC collector (default localhost:4317)", func(c *Config) any { return &c.Tracing.Endpoint }},
+	{"tracing-insecure", "CONNECT4_TRACING_INSECURE", "send traces to the OTLP collector without TLS", func(c *Config) any { return &c.Tracing.Insecure }},
+	{"tls-cert", "CONNECT4_TLS_CERT", "PEM certificate to serve over TLS", func(c *Config) any { return &c.TLS.Cert }},
+	{"tls-key", "CONNECT4_TLS_KEY", "PEM private key of the TLS certificate", func(c *Config) any { return &c.TLS.Key }},
+	{"tls-client-ca", "CONNECT4_TLS_CLIENT_CA", "PEM CA used to verify client certificates (enables mutual TLS)", func(c *Config) any { return &c.TLS.ClientCA }},
+	{"tls-require-client-cert", "CONNECT4_TLS_REQUIRE_CLIENT_CERT", "reject clients without a certificate signed by -tls-client-ca", func(c *Config) any { return &c.TLS.RequireClientCert }},
+	{"token-secret", "CONNECT4_TOKEN_SECRET", "secret used to sign session tokens (random per process when empty)", func(c *Config) any { return &c.Auth.TokenSecret }},
+	{"token-ttl", "CONNECT4_TOKEN_TTL", "lifetime of session tokens", func(c *Config) any { return &c.Auth.TokenTTL }},
+	{"admin-players", "CONNECT4_ADMIN_PLAYERS", "comma-separated accounts allowed to call the Admin service", func(c *Config) any { return &c.Admin.Players }},
+	{"limit-command-rate", "CONNECT4_LIMIT_COMMAND_RATE", "commands per second a session can send, 0 for no limit", func(c *Config) any { return &c.Limits.CommandRate }},
+	{"limit-command-burst", "CONNECT4_LIMIT_COMMAND_BURST", "commands a session can send at once", func(c *Config) any { return &c.Limits.CommandBurst }},
+	{"limit-player-command-rate", "CONNECT4_LIMIT_PLAYER_COMMAND_RATE", "commands per second a player can send across sessions, 0 for no limit", func(c *Config) any { return &c.Limits.PlayerCommandRate }},
+	{"limit-player-command-burst", "CONNECT4_LIMIT_PLAYER_COMMAND_BURST", "commands a player can send at once", func(c *Config) any { return &c.Limits.PlayerCommandBurst }},
+	{"limit-rpc-rate", "CONNECT4_LIMIT_RPC_RATE", "unary RPCs and REST requests per second of an address, 0 for no limit", func(c *Config) any { return &c.Limits.RPCRate }},
+	{"limit-rpc-burst", "CONNECT4_LIMIT_RPC_BURST", "unary RPCs and REST requests an address can make at once", func(c *Config) any { return &c.Limits.RPCBurst }},
+	{"limit-connections-per-ip", "CONNECT4_LIMIT_CONNECTIONS_PER_IP", "game sessions an address can have open, 0 for no limit", func(c *Config) any { return &c.Limits.MaxConnectionsPerIP }},
+	{"limit-message-size", "CONNECT4_LIMIT_MESSAGE_SIZE", "maximum bytes of a gRPC message, WebSocket command or REST body", func(c *Config) any { return &c.Limits.MaxMessageSize }},
+	{"limit-violations", "CONNECT4_LIMIT_VIOLATIONS", "protocol violations within -limit-violation-window that ban an address, 0 to never ban", func(c *Config) any { return &c.Limits.MaxViolations }},
+	{"limit-violation-window", "CONNECT4_LIMIT_VIOLATION_WINDOW", "window the protocol violations of an address are counted in", func(c *Config) any { return &c.Limits.ViolationWindow }},
+	{"limit-ban-duration", "CONNECT4_LIMIT_BAN_DURATION", "how long an address that broke the rules too often is banned", func(c *Config) any { return &c.Limits.BanDuration }},
+	{"send-queue-size", "CONNECT4_SEND_QUEUE_SIZE", "updates queued for a session before it is considered too slow", func(c *Config) any { return &c.Streams.SendQueueSize }},
+	{"slow-player-drops", "CONNECT4_SLOW_PLAYER_DROPS", "updates a player with a full queue can miss in a row before it is disconnected", func(c *Config) any { return &c.Streams.SlowPlayerDrops }},
+	{"heartbeat-interval", "CONNECT4_HEARTBEAT_INTERVAL", "interval between the pings (and gRPC keepalives) sent to each client", func(c *Config) any { return &c.Streams.HeartbeatInterval }},
+	{"heartbeat-timeout", "CONNECT4_HEARTBEAT_TIMEOUT", "how long a client can stay silent before its session is ended", func(c *Config) any { return &c.Streams.HeartbeatTimeout }},
+	{"chat-max-length", "CONNECT4_CHAT_MAX_LENGTH", "maximum number of characters of a chat message", func(c *Config) any { return &c.Chat.MaxLength }},
+	{"chat-blocked-words", "CONNECT4_CHAT_BLOCKED_WORDS", "comma-separated words masked in chat messages", func(c *Config) any { return &c.Chat.BlockedWords }},
+}
+
+// loadConfig resolves the configuration from the config file, the
+// environment and the command-line arguments, and validates it.
+func loadConfig(args []string) (cfg Config, printConfig bool, err error) {
+	cfg = defaultConfig()
+	defaults := defaultConfig()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONNECT4_CONFIG"), "optional YAML config file (env CONNECT4_CONFIG)")
+	fs.BoolVar(&printConfig, "print-config", false, "print the resolved configuration as YAML and exit")
+
+	// Flags are only recorded while parsing, so they can be applied on top of
+	// the config file and the environment afterwards
+	type flagValue struct {
+		option configOption
+		value  string
+	}
+	var setFlags []flagValue
+	for _, option := range configOptions {
+		option := option
+		fs.Var(&optionFlag{
+			field: option.field(&defaults),
+			set:   func(value string) { setFlags = append(setFlags, flagValue{option, value}) },
+		}, option.flag, fmt.Sprintf("%s (env %s)", option.usage, option.env))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+
+	if *configFile != "" {
+		if err := readConfigFile(*configFile, &cfg); err != nil {
+			return cfg, false, err
+		}
+	}
+
+	for _, option := range configOptions {
+		if value, ok := os.LookupEnv(option.env); ok {
+			if err := setField(option.field(&cfg), value); err != nil {
+				return cfg, false, fmt.Errorf("invalid %s: %w", option.env, err)
+			}
+		}
+	}
+
+	for _, f := range setFlags {
+		if err := setField(f.option.field(&cfg), f.value); err != nil {
+			return cfg, false, fmt.Errorf("invalid -%s: %w", f.option.flag, err)
+		}
+	}
+
+	return cfg, printConfig, cfg.Validate()
+}
+
+func readConfigFile(path string, cfg *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true) // Typos in the file are reported instead of silently ignored
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports the first invalid setting of the configuration.
+func (c Config) Validate() error {
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", c.ListenAddr, err)
+	}
+	if c.HTTP.ListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.HTTP.ListenAddr); err != nil {
+			return fmt.Errorf("invalid http listen address %q: %w", c.HTTP.ListenAddr, err)
+		}
+	}
+	if c.Metrics.ListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.ListenAddr); err != nil {
+			return fmt.Errorf("invalid metrics listen address %q: %w", c.Metrics.ListenAddr, err)
+		}
+	}
+	if c.Telnet.ListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Telnet.ListenAddr); err != nil {
+			return fmt.Errorf("invalid telnet listen address %q: %w", c.Telnet.ListenAddr, err)
+		}
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		return fmt.Errorf("invalid tracing exporter %q: must be none, stdout or otlp", c.Tracing.Exporter)
+	}
+	if c.StoragePath == "" {
+		return errors.New("storage path must not be empty")
+	}
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		return err
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("invalid log format %q: must be text or json", c.LogFormat)
+	}
+	if c.MaxGames < 0 {
+		return errors.New("max games must not be negative")
+	}
+	if c.ReconnectGrace < 0 {
+		return errors.New("reconnect grace must not be negative")
+	}
+	if c.ShutdownDrain < 0 {
+		return errors.New("shutdown drain must not be negative")
+	}
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		return errors.New("tls cert and key must be set together")
+	}
+	if c.TLS.Cert == "" && (c.TLS.ClientCA != "" || c.TLS.RequireClientCert) {
+		return errors.New("client certificates require a tls cert and key")
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCA == "" {
+		return errors.New("requiring client certificates needs a client CA")
+	}
+	if c.Auth.TokenSecret != "" && len(c.Auth.TokenSecret) < 16 {
+		return errors.New("token secret must have at least 16 characters")
+	}
+	if c.Auth.TokenTTL <= 0 {
+		return errors.New("token ttl must be positive")
+	}
+	if c.Chat.MaxLength <= 0 {
+		return errors.New("chat max length must be positive")
+	}
+	if err := c.Limits.validate(); err != nil {
+		return err
+	}
+	if c.Streams.SendQueueSize <= 0 {
+		return errors.New("send queue size must be positive")
+	}
+	if c.Streams.SlowPlayerDrops <= 0 {
+		return errors.New("slow player drops must be positive")
+	}
+	if c.Streams.HeartbeatInterval <= 0 || c.Streams.HeartbeatTimeout <= c.Streams.HeartbeatInterval {
+		return errors.New("heartbeat interval must be positive and shorter than the heartbeat timeout")
+	}
+	return nil
+}
+
+// Print writes the configuration as YAML, hiding the token secret.
+func (c Config) Print(w io.Writer) error {
+	if c.Auth.TokenSecret != "" {
+		c.Auth.TokenSecret = "<redacted>"
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+
+	return encoder.Encode(c)
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", level)
+	}
+	return l, nil
+}
+
+// optionFlag is the flag.Value of a config option.
+type optionFlag struct {
+	field any // Pointer to the default value, shown in the usage message
+	set   func(value string)
+}
+
+func (o *optionFlag) String() string {
+	if o == nil || o.field == nil {
+		return ""
+	}
+	switch field := o.field.(type) {
+	case *string:
+		return *field
+	case *int:
+		return strconv.Itoa(*field)
+	case *[]string:
+		return strings.Join(*field, ",")
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *time.Duration:
+		return field.String()
+	}
+	return ""
+}
+
+func (o *optionFlag) Set(value string) error {
+	o.set(value)
+	return nil
+}
+
+func (o *optionFlag) IsBoolFlag() bool {
+	_, ok := o.field.(*bool)
+	return ok
+}
+
+// setField parses value into the field pointed to by field.
+func setField(field any, value string) error {
+	switch field := field.(type) {
+	case *string:
+		*field = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field = n
+	case *[]string:
+		*field = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field = b
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field = d
+	default:
+		return fmt.Errorf("unsupported option type %T", field)
+	}
+	return nil
+}
+
+// logLevel returns the configured log level, already checked by Validate.
+func (c Config) logLevel() slog.Level {
+	level, _ := parseLogLevel(c.LogLevel)
+	return level
+}
+
+func (l LimitsConfig) validate() error {
+	buckets := []struct {
+		name        string
+		rate, burst int
+	}{
+		{"command", l.CommandRate, l.CommandBurst},
+		{"player command", l.PlayerCommandRate, l.PlayerCommandBurst},
+		{"rpc", l.RPCRate, l.RPCBurst},
+	}
+	for _, b := range buckets {
+		if b.rate < 0 {
+			return fmt.Errorf("%s rate limit must not be negative", b.name)
+		}
+		if b.rate > 0 && b.burst <= 0 {
+			return fmt.Errorf("%s burst must be positive", b.name)
+		}
+	}
+	if l.MaxConnectionsPerIP < 0 {
+		return errors.New("max connections per ip must not be negative")
+	}
+	if l.MaxMessageSize <= 0 {
+		return errors.New("max message size must be positive")
+	}
+	if l.MaxViolations < 0 {
+		return errors.New("max violations must not be negative")
+	}
+	if l.MaxViolations > 0 && (l.ViolationWindow <= 0 || l.BanDuration <= 0) {
+		return errors.New("violation window and ban duration must be positive to ban addresses")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a config file to a temporary directory and returns
+// its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, printConfig, err := loadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if printConfig {
+		t.Error("print-config is set without the flag")
+	}
+	if !reflect.DeepEqual(cfg, defaultConfig()) {
+		t.Errorf("got %+v, want the defaults %+v", cfg, defaultConfig())
+	}
+}
+
+func TestHTTPListenersAreLocalByDefault(t *testing.T) {
+	cfg := defaultConfig()
+	for name, addr := range map[string]string{"http": cfg.HTTP.ListenAddr, "metrics": cfg.Metrics.ListenAddr} {
+		if host, _, err := net.SplitHostPort(addr); err != nil || host != "localhost" {
+			t.Errorf("the %s server listens on %q by default, want only localhost", name, addr)
+		}
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+listen_addr: ":6000"
+storage_path: /var/lib/connect4
+log_level: warn
+max_games: 5
+auth:
+  token_ttl: 1h
+chat:
+  max_length: 100
+  blocked_words: [foo]
+limits:
+  command_rate: 3
+`)
+
+	t.Setenv("CONNECT4_STORAGE_PATH", "/srv/connect4")
+	t.Setenv("CONNECT4_TOKEN_TTL", "2h")
+	t.Setenv("CONNECT4_MAX_GAMES", "6")
+	t.Setenv("CONNECT4_CHAT_BLOCKED_WORDS", "bar,baz")
+
+	cfg, _, err := loadConfig([]string{"-config", path, "-token-ttl", "3h", "-log-level=debug", "-limit-command-rate=7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"file over default", cfg.ListenAddr, ":6000"},
+		{"env over file", cfg.StoragePath, "/srv/connect4"},
+		{"env over file, number", cfg.MaxGames, 6},
+		{"env over file, list", cfg.Chat.BlockedWords, []string{"bar", "baz"}},
+		{"file over default, nested", cfg.Chat.MaxLength, 100},
+		{"flag over env, nested", cfg.Auth.TokenTTL, 3 * time.Hour},
+		{"flag over file", cfg.LogLevel, "debug"},
+		{"flag over file, nested", cfg.Limits.CommandRate, 7},
+		{"default next to a nested file setting", cfg.Limits.CommandBurst, defaultConfig().Limits.CommandBurst},
+		{"default next to a nested file setting", cfg.Auth.TokenSecret, defaultConfig().Auth.TokenSecret},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	t.Setenv("CONNECT4_CONFIG", writeConfigFile(t, "log_level: error\n"))
+
+	cfg, _, err := loadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogLevel != "error" {
+		t.Errorf("log level %q, want error from the file in CONNECT4_CONFIG", cfg.LogLevel)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"unknown file field", nil, []string{"-config", writeConfigFile(t, "log_levels: warn\n")}, "log_levels"},
+		{"missing file", nil, []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, "opening config file"},
+		{"invalid env", map[string]string{"CONNECT4_TLS_REQUIRE_CLIENT_CERT": "maybe"}, nil, "CONNECT4_TLS_REQUIRE_CLIENT_CERT"},
+		{"invalid number", map[string]string{"CONNECT4_MAX_GAMES": "many"}, nil, "CONNECT4_MAX_GAMES"},
+		{"invalid flag", nil, []string{"-token-ttl", "soon"}, "token-ttl"},
+		{"invalid setting", nil, []string{"-log-level", "loud"}, "loud"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			_, _, err := loadConfig(test.args)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error mentioning %q", err, test.want)
+			}
+		})
+	}
+}
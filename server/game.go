@@ -0,0 +1,719 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClientInfo is a player seated at a game.
+type ClientInfo struct {
+	IP            string
+	Nickname      string
+	Symbol        string
+	Authenticated bool // Logged in players can take their seat back after a disconnection
+	Spectator     bool // Watching the game without a seat
+
+	Stream connect4.Connect4Game_GameSessionServer // Store the stream reference, so we can broadcast messages to both clients later. Nil while disconnected
+	kick   chan string                             // Ends the session of Stream with a message, nil for streams that can't be kicked
+
+	chatSent []time.Time // When the recent chat messages were sent, for rate limiting
+}
+
+// game is a match between two players, played on its own board. The state
+// of the game is owned by its goroutine: it is only read and changed, and
+// updates are only sent to its clients, by the functions run there with do.
+type game struct {
+	id        string
+	createdAt time.Time
+	options   *connect4.GameOptions // Chosen by the creator, who takes seat 0
+
+	inbox   chan func()   // Functions to run on the game's goroutine
+	stopped chan struct{} // Closed once the game is removed from the server
+
+	gameBoard [ROWS][COLS]int32 // 6 rows, 7 columns
+	moves     []int32           // Columns played in the current game, in order
+
+	players       [2]*ClientInfo // Seated in the order they joined, nil while the seat is free
+	waitingSince  time.Time      // When the first player sat down
+	currentPlayer int            // Index of current player, 0 or 1
+	firstPlayer   int            // Seat that moves first in the current game
+	started       bool
+	gameOver      bool
+	result        *connect4.GameOver // Set when the game is over
+
+	// Score of the series of rematches
+	wins          [2]int32
+	ties          int32
+	gamesPlayed   int32
+	rematchOffers [2]bool // Seats that asked for a rematch of the game that just ended
+
+	spectators  []*ClientInfo
+	chatHistory []*connect4.ChatMessage // Most recent messages of both channels
+
+	abandonTimer *time.Timer // Ends the game if a disconnected player doesn't come back in time
+}
+
+func newGame(options *connect4.GameOptions) *game {
+	if options == nil {
+		options = &connect4.GameOptions{}
+	}
+	g := &game{id: newGameID(), createdAt: time.Now(), options: options}
+	g.start()
+	return g
+}
+
+// start runs the goroutine of the game, until stop is called.
+func (g *game) start() {
+	g.inbox = make(chan func())
+	g.stopped = make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case fn := <-g.inbox:
+				fn()
+			case <-g.stopped:
+				return
+			}
+		}
+	}()
+}
+
+// stop ends the goroutine of a game removed from the server.
+func (g *game) stop() {
+	close(g.stopped)
+}
+
+// do runs fn on the goroutine of the game, after the functions sent before
+// it, and waits for it to return. It reports false, without running fn, if
+// the game was removed from the server. fn must not call do on the same
+// game, nor wait for the server's gamesLock.
+func (g *game) do(fn func()) bool {
+	done := make(chan struct{})
+	select {
+	case g.inbox <- func() { fn(); close(done) }:
+	case <-g.stopped:
+		return false
+	}
+	<-done
+	return true
+}
+
+// validateGameOptions checks the options sent by the creator of a game.
+func validateGameOptions(options *connect4.GameOptions) error {
+	if options == nil {
+		return nil
+	}
+	if _, ok := connect4.GameOptions_FirstMove_name[int32(options.FirstMove)]; !ok {
+		return fmt.Errorf("unknown first move option %d", options.FirstMove)
+	}
+	if options.CreatorSymbol != "" && options.CreatorSymbol != "x" && options.CreatorSymbol != "o" {
+		return fmt.Errorf("invalid symbol %q: must be x or o", options.CreatorSymbol)
+	}
+	return nil
+}
+
+func newGameID() string {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		panic(fmt.Sprintf("reading random game ID: %v", err))
+	}
+	return hex.EncodeToString(id)
+}
+
+// isWaiting reports whether the game has a free seat. It must run on the game's goroutine.
+func (g *game) isWaiting() bool {
+	return !g.started && (g.players[0] == nil || g.players[1] == nil)
+}
+
+// isEmpty reports whether every player left the game, so it can be
+// discarded. It must run on the game's goroutine.
+func (g *game) isEmpty() bool {
+	for _, player := range g.players {
+		if player != nil && (player.Stream != nil || g.abandonTimer != nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// opponent returns the seat of the other player.
+func opponent(seat int) int {
+	return seat ^ 1
+}
+
+// seat takes a free seat for the client, or gives a logged in player back
+// its seat. A player that comes back before its old connection is found to
+// be dead takes the seat over, and the old session is ended. It must run on
+// the game's goroutine.
+func (g *game) seat(client *ClientInfo) (int, error) {
+	for i, player := range g.players {
+		if player != nil && player.Authenticated && client.Authenticated && player.Nickname == client.Nickname {
+			if player.Stream != nil && !player.disconnect("Disconnected: you joined the game from another connection.") {
+				continue
+			}
+			player.IP = client.IP
+			player.Stream = client.Stream
+			player.kick = client.kick
+			client.Symbol = player.Symbol
+			g.resume(i)
+			return i, nil
+		}
+	}
+
+	if !g.isWaiting() {
+		return 0, status.Errorf(codes.FailedPrecondition, "game %s is full", g.id)
+	}
+
+	seat := 0
+	if g.players[0] != nil {
+		seat = 1
+	}
+	client.Symbol = g.chooseSymbol(seat)
+	g.players[seat] = client
+
+	waiting := g.players[opponent(seat)] == nil
+	g.send(seat, &connect4.GameUpdate{
+		Message: "Welcome to Connect Four, " + client.Nickname + "! You are in game " + g.id + ".",
+		Event:   &connect4.GameUpdate_Welcome{Welcome: &connect4.Welcome{Nickname: client.Nickname, Symbol: client.Symbol, WaitingForOpponent: waiting, GameId: g.id}},
+	})
+
+	g.sendChatHistory(client)
+
+	if waiting {
+		g.waitingSince = time.Now()
+		g.send(seat, &connect4.GameUpdate{Message: "Just a second! Waiting for another player to connect"})
+		return seat, nil
+	}
+
+	matchmakingWait.Observe(time.Since(g.waitingSince).Seconds())
+	g.started = true
+	g.chooseFirstPlayer()
+	slog.Info("game started", "game", g.id, "players", []string{g.players[0].Nickname, g.players[1].Nickname}, "first", g.players[g.firstPlayer].Nickname)
+
+	started := &connect4.GameUpdate_GameStarted{GameStarted: g.gameStarted()}
+	firstMove := g.players[g.firstPlayer].Nickname + " moves first, " + g.firstMoveReason() + "."
+	g.send(opponent(seat), &connect4.GameUpdate{Message: client.Nickname + " has joined the game! " + firstMove, Event: started})
+	g.send(seat, &connect4.GameUpdate{Message: "You are now connected. " + firstMove, Event: started})
+	g.watch(&connect4.GameUpdate{Message: client.Nickname + " has joined the game! " + firstMove, Event: started})
+	g.broadcastTurn(-1)
+
+	return seat, nil
+}
+
+// resume brings a player that came back up to date with the game. It
+// must run on the game's goroutine.
+func (g *game) resume(seat int) {
+	// In a game restored after a restart the opponent may still be away,
+	// and keeps its time to come back
+	if other := g.players[opponent(seat)]; other == nil || other.Stream != nil {
+		g.stopAbandonTimer()
+	}
+
+	client := g.players[seat]
+	g.send(seat, &connect4.GameUpdate{
+		Message: "Welcome back, " + client.Nickname + "! You are in game " + g.id + ".",
+		Event:   &connect4.GameUpdate_Welcome{Welcome: &connect4.Welcome{Nickname: client.Nickname, Symbol: client.Symbol, WaitingForOpponent: !g.started, GameId: g.id}},
+	})
+
+	g.sendChatHistory(client)
+
+	if !g.started {
+		return
+	}
+	g.sendProgress(client)
+	g.send(opponent(seat), &connect4.GameUpdate{Message: client.Nickname + " is back."})
+
+	if other := g.players[opponent(seat)]; g.gameOver && g.rematchOffers[opponent(seat)] {
+		g.send(seat, &connect4.GameUpdate{
+			Message: other.Nickname + " wants a rematch!",
+			Event:   &connect4.GameUpdate_RematchOffered{RematchOffered: &connect4.RematchOffered{From: other.Nickname}},
+		})
+	}
+}
+
+// sendProgress sends the players, board and turn (or result) of a started
+// game to a client that joins it midway. It must run on the game's goroutine.
+func (g *game) sendProgress(client *ClientInfo) {
+	client.send(&connect4.GameUpdate{Event: &connect4.GameUpdate_GameStarted{GameStarted: g.gameStarted()}})
+
+	if g.gameOver {
+		result := &connect4.GameOver{Reason: g.result.Reason, Winner: g.result.Winner, YouWon: !client.Spectator && g.result.Winner == client.Nickname}
+		client.send(&connect4.GameUpdate{Board: g.formatBoard(), Event: &connect4.GameUpdate_GameOver{GameOver: result}})
+		return
+	}
+
+	current := g.players[g.currentPlayer]
+	yourTurn := current == client
+	message := "Waiting for " + current.Nickname + " to make a move."
+	if yourTurn {
+		message = "It's your turn!"
+	}
+	client.send(&connect4.GameUpdate{
+		Message: message,
+		Board:   g.formatBoard(),
+		Event:   &connect4.GameUpdate_TurnChanged{TurnChanged: &connect4.TurnChanged{Player: current.Nickname, YourTurn: yourTurn, LastColumn: -1}},
+	})
+}
+
+// addSpectator lets the client watch the game. It must run on the game's goroutine.
+func (g *game) addSpectator(client *ClientInfo) {
+	client.Spectator = true
+	g.spectators = append(g.spectators, client)
+
+	client.send(&connect4.GameUpdate{
+		Message: "You are watching game " + g.id + ".",
+		Event:   &connect4.GameUpdate_Welcome{Welcome: &connect4.Welcome{Nickname: client.Nickname, WaitingForOpponent: !g.started, GameId: g.id, Spectator: true}},
+	})
+	g.sendChatHistory(client)
+
+	if g.started {
+		g.sendProgress(client)
+	}
+}
+
+// gameClosed is the last update sent to the spectators of a game removed
+// from the server.
+func gameClosed(g *game) *connect4.GameUpdate {
+	return &connect4.GameUpdate{
+		Message: "Game " + g.id + " was closed, as everyone left it.",
+		Event:   &connect4.GameUpdate_GameClosed{GameClosed: &connect4.GameClosed{GameId: g.id}},
+	}
+}
+
+// removeSpectator stops sending the game to the client.
+func (g *game) removeSpectator(client *ClientInfo) {
+	g.do(func() {
+		for i, spectator := range g.spectators {
+			if spectator == client {
+				g.spectators = append(g.spectators[:i], g.spectators[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// handleMoveCommand processes the move command of the player in seat. The
+// span of the command in ctx gets the time spent waiting for the game's
+// goroutine and the outcome of the move.
+func (g *game) handleMoveCommand(ctx context.Context, seat int, column int32) {
+	span := trace.SpanFromContext(ctx)
+
+	g.do(func() {
+		span.AddEvent("command dequeued")
+
+		result := "rejected"
+		defer func() { span.SetAttributes(attribute.String("connect4.move_result", result)) }()
+
+		if g.gameOver {
+			g.send(seat, moveRejected("The game is over.", connect4.MoveRejected_GAME_OVER))
+			return
+		}
+
+		if !g.started {
+			g.send(seat, moveRejected("Just a second! Waiting for another player to connect.", connect4.MoveRejected_WAITING_FOR_OPPONENT))
+			return
+		}
+
+		if g.currentPlayer != seat {
+			g.send(seat, moveRejected("It's not your turn yet.", connect4.MoveRejected_NOT_YOUR_TURN))
+			return
+		}
+
+		if !g.isValidMove(column) {
+			g.send(seat, moveRejected("Invalid move. Try again.", connect4.MoveRejected_INVALID_COLUMN))
+			return
+		}
+
+		g.applyMove(column, g.players[seat].Symbol)
+		g.moves = append(g.moves, column)
+		movesPlayed.Inc()
+		span.AddEvent("move applied") // What follows is sending the updates
+
+		result = "accepted"
+		winner := g.checkForWinner()
+		switch winner {
+		case "Tie":
+			result = "board_full"
+			g.endGame(connect4.GameOver_BOARD_FULL, -1, "The game is a tie.", "The game is a tie.")
+			return // End game session after a tie
+		case "":
+			g.switchPlayerTurn()
+			g.broadcastTurn(column)
+		default:
+			result = "four_in_a_row"
+			g.endGame(connect4.GameOver_FOUR_IN_A_ROW, g.currentPlayer, "Congratulations, "+winner+"! You won!", "You lost. Better luck next time.")
+			return // End game session after a win
+		}
+	})
+}
+
+// handleRematchCommand offers a rematch to the opponent of the player in
+// seat, or accepts the opponent's offer, starting a new game on the same
+// streams.
+func (g *game) handleRematchCommand(seat int) {
+	g.do(func() {
+		if !g.gameOver {
+			g.send(seat, &connect4.GameUpdate{Message: "You can only ask for a rematch once the game is over."})
+			return
+		}
+
+		other := g.players[opponent(seat)]
+		if other.Stream == nil {
+			g.send(seat, &connect4.GameUpdate{Message: other.Nickname + " left the game, there is nobody to play a rematch with."})
+			return
+		}
+
+		g.rematchOffers[seat] = true
+		if !g.rematchOffers[opponent(seat)] {
+			nickname := g.players[seat].Nickname
+			g.send(seat, &connect4.GameUpdate{Message: "Rematch offered. Waiting for " + other.Nickname + " to accept."})
+			g.send(opponent(seat), &connect4.GameUpdate{
+				Message: nickname + " wants a rematch!",
+				Event:   &connect4.GameUpdate_RematchOffered{RematchOffered: &connect4.RematchOffered{From: nickname}},
+			})
+			return
+		}
+
+		g.rematch()
+	})
+}
+
+// rematch clears the board and starts a new game between the same players.
+// It must run on the game's goroutine.
+func (g *game) rematch() {
+	g.gameBoard = [ROWS][COLS]int32{}
+	g.moves = nil
+	g.gameOver = false
+	g.result = nil
+	g.rematchOffers = [2]bool{}
+	g.chooseFirstPlayer()
+
+	started := &connect4.GameUpdate{
+		Message: fmt.Sprintf("Rematch! Game %d of the series, %s moves first, %s.", g.gamesPlayed+1, g.players[g.firstPlayer].Nickname, g.firstMoveReason()),
+		Event:   &connect4.GameUpdate_GameStarted{GameStarted: g.gameStarted()},
+	}
+	g.broadcast(started, started)
+	g.watch(started)
+	g.broadcastTurn(-1)
+}
+
+// handleResignCommand ends the game with a win for the opponent of the
+// player who resigned.
+func (g *game) handleResignCommand(seat int) {
+	g.do(func() {
+		if g.gameOver || !g.started {
+			g.send(seat, moveRejected("There is no game in progress to resign.", connect4.MoveRejected_GAME_OVER))
+			return
+		}
+
+		// The winner is made the current player so it receives the winning message
+		g.currentPlayer = opponent(seat)
+		g.endGame(connect4.GameOver_RESIGNATION, g.currentPlayer, g.players[seat].Nickname+" resigned. You won!", "You resigned.")
+	})
+}
+
+// abandon gives the win to the opponent of the player in seat, who left the
+// game. It must run on the game's goroutine.
+func (g *game) abandon(seat int) {
+	g.currentPlayer = opponent(seat)
+	g.endGame(connect4.GameOver_ABANDONED, g.currentPlayer, g.players[seat].Nickname+" left the game. You won!", "")
+}
+
+// abort ends the game without a result, so it doesn't count in the series.
+// It must run on the game's goroutine.
+func (g *game) abort(message string) {
+	g.gameOver = true
+	g.stopAbandonTimer()
+	gamesFinished.WithLabelValues(metricLabel(connect4.GameOver_ABORTED.String())).Inc()
+	slog.Info("game over", "game", g.id, "reason", metricLabel(connect4.GameOver_ABORTED.String()), "moves", len(g.moves))
+
+	g.result = &connect4.GameOver{Reason: connect4.GameOver_ABORTED, Series: g.series()}
+	update := &connect4.GameUpdate{Message: message, Board: g.formatBoard(), Event: &connect4.GameUpdate_GameOver{GameOver: g.result}}
+	g.broadcast(update, update)
+	g.watch(update)
+}
+
+// endGame announces the result to both players. winnerSeat is -1 on a tie,
+// and otherwise the current player. It must run on the game's goroutine.
+func (g *game) endGame(reason connect4.GameOver_Reason, winnerSeat int, activeMessage string, otherMessage string) {
+	g.gameOver = true
+	g.stopAbandonTimer()
+	gamesFinished.WithLabelValues(metricLabel(reason.String())).Inc()
+
+	g.gamesPlayed++
+	if winnerSeat >= 0 {
+		g.wins[winnerSeat]++
+	} else {
+		g.ties++
+	}
+
+	g.result = &connect4.GameOver{Reason: reason, Series: g.series()}
+	if winnerSeat >= 0 {
+		g.result.Winner = g.players[winnerSeat].Nickname
+	}
+	slog.Info("game over", "game", g.id, "reason", metricLabel(reason.String()), "winner", g.result.Winner, "moves", len(g.moves))
+
+	board := g.formatBoard()
+	g.broadcast(
+		&connect4.GameUpdate{Message: activeMessage, Board: board, Event: &connect4.GameUpdate_GameOver{GameOver: &connect4.GameOver{Reason: reason, Winner: g.result.Winner, YouWon: winnerSeat >= 0, Series: g.result.Series}}},
+		&connect4.GameUpdate{Message: otherMessage, Board: board, Event: &connect4.GameUpdate_GameOver{GameOver: g.result}},
+	)
+
+	spectatorMessage := "The game is a tie."
+	if winnerSeat >= 0 {
+		spectatorMessage = g.result.Winner + " won the game."
+	}
+	g.watch(&connect4.GameUpdate{Message: spectatorMessage, Board: board, Event: &connect4.GameUpdate_GameOver{GameOver: g.result}})
+}
+
+// broadcastTurn tells both players whose turn it is after a move in
+// lastColumn (-1 at the start of the game). It must run on the game's goroutine.
+func (g *game) broadcastTurn(lastColumn int32) {
+	current := g.players[g.currentPlayer].Nickname
+	otherMessage := "Move accepted. " + current + "'s turn"
+	if lastColumn < 0 {
+		otherMessage = "Waiting for " + current + " to make a move."
+	}
+
+	board := g.formatBoard()
+	g.broadcast(
+		&connect4.GameUpdate{Message: "It's your turn!", Board: board, Event: &connect4.GameUpdate_TurnChanged{TurnChanged: &connect4.TurnChanged{Player: current, YourTurn: true, LastColumn: lastColumn}}},
+		&connect4.GameUpdate{Message: otherMessage, Board: board, Event: &connect4.GameUpdate_TurnChanged{TurnChanged: &connect4.TurnChanged{Player: current, LastColumn: lastColumn}}},
+	)
+	g.watch(&connect4.GameUpdate{Message: current + "'s turn.", Board: board, Event: &connect4.GameUpdate_TurnChanged{TurnChanged: &connect4.TurnChanged{Player: current, LastColumn: lastColumn}}})
+}
+
+// gameStarted describes the players of the game. It must run on the game's goroutine.
+func (g *game) gameStarted() *connect4.GameStarted {
+	series := g.series()
+	return &connect4.GameStarted{Players: series.Players, FirstPlayer: g.players[g.firstPlayer].Nickname, Series: series, FirstMove: g.options.FirstMove}
+}
+
+// chooseFirstPlayer picks the seat that moves first in the next game. The
+// first move option of the game decides the first one, and rematches swap
+// it unless the option redraws it every game. It must run on the game's goroutine.
+func (g *game) chooseFirstPlayer() {
+	switch {
+	case g.gamesPlayed > 0 && g.options.FirstMove != connect4.GameOptions_REDRAW:
+		g.firstPlayer = opponent(g.firstPlayer)
+	case g.options.FirstMove == connect4.GameOptions_CREATOR:
+		g.firstPlayer = 1
+		if g.options.CreatorMovesFirst {
+			g.firstPlayer = 0
+		}
+	default:
+		g.firstPlayer = mathrand.Intn(2)
+	}
+	g.currentPlayer = g.firstPlayer
+}
+
+// firstMoveReason explains how the first player of the current game was
+// chosen. It must run on the game's goroutine.
+func (g *game) firstMoveReason() string {
+	switch {
+	case g.gamesPlayed > 0 && g.options.FirstMove != connect4.GameOptions_REDRAW:
+		return "taking turns every game"
+	case g.options.FirstMove == connect4.GameOptions_CREATOR:
+		return "as chosen by " + g.players[0].Nickname
+	default:
+		return "drawn at random"
+	}
+}
+
+// series returns the score of the games played so far. It must run on the
+// game's goroutine.
+func (g *game) series() *connect4.Series {
+	series := &connect4.Series{Ties: g.ties, GamesPlayed: g.gamesPlayed}
+	for seat, client := range g.players {
+		series.Players = append(series.Players, &connect4.Player{Nickname: client.Nickname, Symbol: client.Symbol, Wins: g.wins[seat]})
+	}
+	return series
+}
+
+// stopAbandonTimer cancels the pending abandonment of the game, if any. It
+// must run on the game's goroutine.
+func (g *game) stopAbandonTimer() {
+	if g.abandonTimer != nil {
+		g.abandonTimer.Stop()
+		g.abandonTimer = nil
+	}
+}
+
+// broadcast sends active to the player whose turn it is and other to the
+// other player. It must run on the game's goroutine.
+func (g *game) broadcast(active *connect4.GameUpdate, other *connect4.GameUpdate) {
+	for i, client := range g.players {
+		if client != nil && client.Stream != nil {
+			update := other
+			if i == g.currentPlayer {
+				update = active
+			}
+
+			if update.Message != "" || update.Event != nil {
+				client.send(update)
+			}
+		}
+	}
+}
+
+// watch sends an update to the spectators. It must run on the game's goroutine.
+func (g *game) watch(update *connect4.GameUpdate) {
+	for _, spectator := range g.spectators {
+		spectator.send(update)
+	}
+}
+
+// send sends an update to the player in seat, if connected. It must run on the game's goroutine.
+func (g *game) send(seat int, update *connect4.GameUpdate) {
+	if client := g.players[seat]; client != nil && client.Stream != nil {
+		client.send(update)
+	}
+}
+
+// disconnect ends the session of the client, telling it message. It reports
+// whether the client could be disconnected. It must run on the goroutine of
+// the client's game.
+func (c *ClientInfo) disconnect(message string) bool {
+	if c.kick == nil {
+		return false
+	}
+	select {
+	case c.kick <- message:
+	default: // Already being disconnected
+	}
+	return true
+}
+
+// send sends an update to the client, counting the failures. It must run on
+// the goroutine of the client's game.
+func (c *ClientInfo) send(update *connect4.GameUpdate) {
+	if err := c.Stream.Send(update); err != nil {
+		streamErrors.WithLabelValues("send").Inc()
+	}
+}
+
+// Game logic functions and helpers
+func (g *game) isValidMove(column int32) bool {
+	return column >= 0 && column < COLS && g.gameBoard[0][column] == 0
+}
+
+func (g *game) applyMove(column int32, symbol string) {
+	for i := ROWS - 1; i >= 0; i-- {
+		if g.gameBoard[i][column] == 0 {
+			playerMark := int32(1)
+			if symbol == "o" {
+				playerMark = 2
+			}
+			g.gameBoard[i][column] = playerMark
+			break
+		}
+	}
+}
+
+func (g *game) checkForWinner() string {
+	// Check rows for a 4-in-a-row
+	for i := 0; i < ROWS; i++ {
+		for j := 0; j < COLS-3; j++ {
+			if g.gameBoard[i][j] != 0 && g.gameBoard[i][j] == g.gameBoard[i][j+1] && g.gameBoard[i][j] == g.gameBoard[i][j+2] && g.gameBoard[i][j] == g.gameBoard[i][j+3] {
+				return g.players[g.currentPlayer].Nickname
+			}
+		}
+	}
+
+	// Check columns for a 4-in-a-row
+	for j := 0; j < COLS; j++ {
+		for i := 0; i < ROWS-3; i++ {
+			if g.gameBoard[i][j] != 0 && g.gameBoard[i][j] == g.gameBoard[i+1][j] && g.gameBoard[i][j] == g.gameBoard[i+2][j] && g.gameBoard[i][j] == g.gameBoard[i+3][j] {
+				return g.players[g.currentPlayer].Nickname
+			}
+		}
+	}
+
+	// Check positive diagonal for a 4-in-a-row
+	for i := 0; i < ROWS-3; i++ {
+		for j := 0; j < COLS-3; j++ {
+			if g.gameBoard[i][j] != 0 && g.gameBoard[i][j] == g.gameBoard[i+1][j+1] && g.gameBoard[i][j] == g.gameBoard[i+2][j+2] && g.gameBoard[i][j] == g.gameBoard[i+3][j+3] {
+				return g.players[g.currentPlayer].Nickname
+			}
+		}
+	}
+
+	// Check negative diagonal for a 4-in-a-row
+	for i := 0; i < ROWS-3; i++ {
+		for j := 3; j < COLS; j++ {
+			if g.gameBoard[i][j] != 0 && g.gameBoard[i][j] == g.gameBoard[i+1][j-1] && g.gameBoard[i][j] == g.gameBoard[i+2][j-2] && g.gameBoard[i][j] == g.gameBoard[i+3][j-3] {
+				return g.players[g.currentPlayer].Nickname
+			}
+		}
+	}
+
+	// Check for a tie (no empty spaces left)
+	for i := 0; i < ROWS; i++ {
+		for j := 0; j < COLS; j++ {
+			if g.gameBoard[i][j] == 0 {
+				return ""
+			}
+		}
+	}
+
+	return "Tie" // If no empty cells and no winner, it's a tie
+}
+
+func (g *game) switchPlayerTurn() {
+	g.currentPlayer ^= 1 // Toggle between 0 and 1 using XOR
+}
+
+// Formatting functions
+func (g *game) formatBoard() string {
+	var boardStr string
+	for i := 0; i < ROWS; i++ {
+		for j := 0; j < COLS; j++ {
+			cellSymbol := getCellSymbol(g.gameBoard[i][j])
+			boardStr += fmt.Sprintf("[%s]", cellSymbol)
+		}
+		boardStr += "\n"
+	}
+	return boardStr
+}
+
+// chooseSymbol returns the symbol of the player in seat: the one chosen by
+// the creator for seat 0, and the other one for seat 1.
+func (g *game) chooseSymbol(seat int) string {
+	creator := g.options.CreatorSymbol
+	if creator == "" {
+		creator = "x"
+	}
+
+	if seat == 0 {
+		return creator
+	}
+	if creator == "x" {
+		return "o"
+	}
+	return "x"
+}
+
+func getCellSymbol(value int32) string {
+	switch value {
+	case 0:
+		return " "
+	case 1:
+		return "x"
+	case 2:
+		return "o"
+	default:
+		return "?"
+	}
+}
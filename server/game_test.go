@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+)
+
+// firstPlayers returns who moves first in each of the games of a series
+// played with options.
+func firstPlayers(options *connect4.GameOptions, games int) []int {
+	g := &game{options: options}
+	var first []int
+	for ; g.gamesPlayed < int32(games); g.gamesPlayed++ {
+		g.chooseFirstPlayer()
+		first = append(first, g.firstPlayer)
+	}
+	return first
+}
+
+func TestFirstPlayerSwapsOnRematch(t *testing.T) {
+	tests := map[string]*connect4.GameOptions{
+		"random":               {FirstMove: connect4.GameOptions_RANDOM},
+		"creator moves first":  {FirstMove: connect4.GameOptions_CREATOR, CreatorMovesFirst: true},
+		"opponent moves first": {FirstMove: connect4.GameOptions_CREATOR},
+	}
+	for name, options := range tests {
+		for draw := 0; draw < 10; draw++ { // The first game is drawn for some
+			first := firstPlayers(options, 6)
+			for i := 1; i < len(first); i++ {
+				if first[i] == first[i-1] {
+					t.Fatalf("%s: %v moved first, want the seats swapped every rematch", name, first)
+				}
+			}
+		}
+	}
+}
+
+func TestFirstPlayerChosenByCreator(t *testing.T) {
+	if first := firstPlayers(&connect4.GameOptions{FirstMove: connect4.GameOptions_CREATOR, CreatorMovesFirst: true}, 1); first[0] != 0 {
+		t.Errorf("seat %d moved first, want the creator", first[0])
+	}
+	if first := firstPlayers(&connect4.GameOptions{FirstMove: connect4.GameOptions_CREATOR}, 1); first[0] != 1 {
+		t.Errorf("seat %d moved first, want the opponent of the creator", first[0])
+	}
+}
+
+func TestFirstPlayerDrawnAtRandom(t *testing.T) {
+	// 64 draws all landing on the same seat would mean they aren't random
+	var firstGames, redraws [2]int
+	for i := 0; i < 64; i++ {
+		firstGames[firstPlayers(&connect4.GameOptions{}, 1)[0]]++
+		redraws[firstPlayers(&connect4.GameOptions{FirstMove: connect4.GameOptions_REDRAW}, 2)[1]]++
+	}
+	if firstGames[0] == 0 || firstGames[1] == 0 {
+		t.Errorf("the first game was always started by the same seat: %v", firstGames)
+	}
+	if redraws[0] == 0 || redraws[1] == 0 {
+		t.Errorf("rematches with redraw were always started by the same seat: %v", redraws)
+	}
+}
+
+func TestFirstMoveReason(t *testing.T) {
+	tests := []struct {
+		options     *connect4.GameOptions
+		gamesPlayed int32
+		want        string
+	}{
+		{&connect4.GameOptions{}, 0, "drawn at random"},
+		{&connect4.GameOptions{}, 1, "taking turns every game"},
+		{&connect4.GameOptions{FirstMove: connect4.GameOptions_CREATOR}, 0, "as chosen by alice"},
+		{&connect4.GameOptions{FirstMove: connect4.GameOptions_CREATOR}, 2, "taking turns every game"},
+		{&connect4.GameOptions{FirstMove: connect4.GameOptions_REDRAW}, 3, "drawn at random"},
+	}
+	for _, test := range tests {
+		g := &game{options: test.options, gamesPlayed: test.gamesPlayed, players: [2]*ClientInfo{{Nickname: "alice"}, {Nickname: "bob"}}}
+		if got := g.firstMoveReason(); got != test.want {
+			t.Errorf("%v after %d games: got %q, want %q", test.options.FirstMove, test.gamesPlayed, got, test.want)
+		}
+	}
+}
+
+func TestValidateGameOptions(t *testing.T) {
+	valid := []*connect4.GameOptions{
+		nil,
+		{},
+		{FirstMove: connect4.GameOptions_REDRAW, CreatorSymbol: "o"},
+	}
+	for _, options := range valid {
+		if err := validateGameOptions(options); err != nil {
+			t.Errorf("%v: %v", options, err)
+		}
+	}
+
+	invalid := []*connect4.GameOptions{
+		{FirstMove: 2}, // Reserved
+		{FirstMove: 42},
+		{CreatorSymbol: "z"},
+	}
+	for _, options := range invalid {
+		if err := validateGameOptions(options); err == nil {
+			t.Errorf("%v: accepted", options)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// keepaliveMinTime is the shortest interval between the gRPC keepalive
+// pings of a client that the server tolerates.
+const keepaliveMinTime = 5 * time.Second
+
+// keepaliveOptions make the gRPC server ping idle connections every
+// heartbeat interval and close the ones that don't answer in time, which
+// also ends the half-open connections of clients that never opened a game.
+func keepaliveOptions(cfg StreamsConfig) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: cfg.HeartbeatInterval, Timeout: cfg.HeartbeatTimeout - cfg.HeartbeatInterval}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: keepaliveMinTime, PermitWithoutStream: true}),
+	}
+}
+
+// ping is sent to the client every heartbeat interval.
+func ping() *connect4.GameUpdate {
+	return &connect4.GameUpdate{Event: &connect4.GameUpdate_Ping{Ping: &connect4.Ping{SentAt: time.Now().UnixMicro()}}}
+}
+
+// handleHeartbeat answers a "ping" command and measures the round trip of
+// a "pong", reporting whether the command was one of them.
+func handleHeartbeat(in *connect4.GameCommand, stream connect4.Connect4Game_GameSessionServer) bool {
+	switch in.Command {
+	case "ping":
+		stream.Send(&connect4.GameUpdate{Event: &connect4.GameUpdate_Pong{Pong: &connect4.Pong{SentAt: in.SentAt}}})
+	case "pong":
+		if roundTrip := time.Since(time.UnixMicro(in.SentAt)); in.SentAt > 0 && roundTrip >= 0 {
+			heartbeatRoundTrip.Observe(roundTrip.Seconds())
+		}
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientsThatNeverAnswerPingsAreKept(t *testing.T) {
+	s := newTestServer(t)
+	s.heartbeatInterval, s.heartbeatTimeout = 10*time.Millisecond, 30*time.Millisecond
+	client := dialTestServer(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, stream := openTestGame(t, ctx, client)
+	for pings := 0; pings < 10; {
+		update, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("the session of a client that never answered pings ended after %d of them: %v", pings, err)
+		}
+		if update.GetPing() != nil {
+			pings++
+		}
+	}
+}
+
+func TestClientsThatStopAnsweringPingsTimeOut(t *testing.T) {
+	s := newTestServer(t)
+	s.heartbeatInterval, s.heartbeatTimeout = 10*time.Millisecond, 30*time.Millisecond
+	client := dialTestServer(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, stream := openTestGame(t, ctx, client)
+	answered := false
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			if !answered {
+				t.Fatalf("the session ended before the client answered a ping: %v", err)
+			}
+			if status.Code(err) != codes.DeadlineExceeded {
+				t.Errorf("got %v, want %v", err, codes.DeadlineExceeded)
+			}
+			return
+		}
+		if ping := update.GetPing(); ping != nil && !answered {
+			stream.Send(&connect4.GameCommand{Command: "pong", SentAt: ping.SentAt})
+			answered = true
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/tls"
+	"embed"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// webFiles is the browser client, served at the root of the HTTP server.
+//
+//go:embed web
+var webFiles embed.FS
+
+// newHTTPServer builds the HTTP server that serves the game to clients that
+// can't use gRPC. It shares the TLS configuration of the gRPC server, if
+// any.
+func newHTTPServer(cfg Config, s *server, tlsConfig *tls.Config) (*http.Server, error) {
+	allowedOrigin := checkOrigin(cfg.HTTP.AllowedOrigins)
+	upgrader := &websocket.Upgrader{CheckOrigin: allowedOrigin}
+
+	gateway, err := s.newGateway()
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /ws", s.serveWebSocket(upgrader))
+	mux.Handle("GET /games/{id}/events", s.serveEvents(allowedOrigin))
+	mux.Handle("GET /v1/", gateway)
+	mux.Handle("POST /v1/", gateway)
+	mux.HandleFunc("GET /openapi.json", serveOpenAPI)
+	if cfg.Metrics.Public {
+		mux.Handle("GET /metrics", promhttp.Handler())
+	}
+
+	web, _ := fs.Sub(webFiles, "web")
+	mux.Handle("GET /", http.FileServerFS(web))
+
+	return &http.Server{
+		Addr:              cfg.HTTP.ListenAddr,
+		Handler:           logRequests(mux),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}, nil
+}
+
+// newMetricsServer builds the HTTP server of the Prometheus metrics, which
+// listens apart from the game so it can be kept off public networks.
+func newMetricsServer(cfg MetricsConfig) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+
+	return &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
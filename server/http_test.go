@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsArePrivateByDefault(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name    string
+		public  bool
+		handler func(cfg Config) http.Handler
+		want    int
+	}{
+		{"public server", false, func(cfg Config) http.Handler { return mustHTTPServer(t, cfg, s).Handler }, http.StatusNotFound},
+		{"public server with metrics-public", true, func(cfg Config) http.Handler { return mustHTTPServer(t, cfg, s).Handler }, http.StatusOK},
+		{"metrics server", false, func(cfg Config) http.Handler { return newMetricsServer(cfg.Metrics).Handler }, http.StatusOK},
+	}
+	for _, test := range tests {
+		cfg := defaultConfig()
+		cfg.Metrics.Public = test.public
+
+		rec := httptest.NewRecorder()
+		test.handler(cfg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if rec.Code != test.want {
+			t.Errorf("%s: GET /metrics got %d, want %d", test.name, rec.Code, test.want)
+		}
+	}
+}
+
+func mustHTTPServer(t *testing.T, cfg Config, s *server) *http.Server {
+	t.Helper()
+	httpServer, err := newHTTPServer(cfg, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httpServer
+}
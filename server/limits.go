@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// knownCommands are the commands of a game session. Anything else is a
+// protocol violation.
+var knownCommands = map[string]bool{
+	"connect": true, "create": true, "join": true, "spectate": true,
+	"move": true, "resign": true, "rematch": true, "list": true, "chat": true, "emote": true,
+	"ping": true, "pong": true,
+}
+
+// limiter protects the server from abusive clients, with token buckets on
+// the commands of each session and player and on the unary RPCs of each
+// address, a cap on the sessions open from an address, and temporary bans
+// of the addresses that keep breaking the rules.
+type limiter struct {
+	cfg LimitsConfig
+
+	mu          sync.Mutex
+	connections map[string]int             // Open sessions, by address
+	players     map[string]*rate.Limiter   // Command buckets, by lower-cased nickname
+	rpcs        map[string]*rate.Limiter   // Unary RPC buckets, by address
+	violations  map[string]*violationCount // By address
+	bannedUntil map[string]time.Time       // By address
+}
+
+type violationCount struct {
+	count int
+	since time.Time // Start of the window the violations are counted in
+}
+
+func newLimiter(cfg LimitsConfig) *limiter {
+	return &limiter{
+		cfg:         cfg,
+		connections: make(map[string]int),
+		players:     make(map[string]*rate.Limiter),
+		rpcs:        make(map[string]*rate.Limiter),
+		violations:  make(map[string]*violationCount),
+		bannedUntil: make(map[string]time.Time),
+	}
+}
+
+// newBucket returns a token bucket refilled with perSecond tokens a second,
+// which never runs out when perSecond is 0.
+func newBucket(perSecond int, burst int) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), burst)
+}
+
+// newSessionBucket returns the bucket of the commands of one session.
+func (l *limiter) newSessionBucket() *rate.Limiter {
+	return newBucket(l.cfg.CommandRate, l.cfg.CommandBurst)
+}
+
+// connect counts a session opened from addr, failing if the address is
+// banned or already has too many sessions. release must be called once the
+// session ends.
+func (l *limiter) connect(addr string) (release func(), err error) {
+	host := addressHost(addr)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.checkBan(host); err != nil {
+		return nil, err
+	}
+	if l.cfg.MaxConnectionsPerIP > 0 && l.connections[host] >= l.cfg.MaxConnectionsPerIP {
+		rateLimited.WithLabelValues("connections_per_ip").Inc()
+		return nil, status.Errorf(codes.ResourceExhausted, "too many connections from %s", host)
+	}
+
+	l.connections[host]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if l.connections[host]--; l.connections[host] <= 0 {
+			delete(l.connections, host)
+		}
+	}, nil
+}
+
+// allowPlayer takes a token from the command bucket of the player, which
+// all of their sessions share.
+func (l *limiter) allowPlayer(nickname string) bool {
+	l.mu.Lock()
+	bucket := l.players[accountKey(nickname)]
+	if bucket == nil {
+		bucket = newBucket(l.cfg.PlayerCommandRate, l.cfg.PlayerCommandBurst)
+		l.players[accountKey(nickname)] = bucket
+	}
+	l.mu.Unlock()
+
+	return bucket.Allow()
+}
+
+// allowRPC takes a token from the RPC bucket of addr, failing if there is
+// none left or the address is banned.
+func (l *limiter) allowRPC(ctx context.Context, addr string) error {
+	host := addressHost(addr)
+
+	l.mu.Lock()
+	if err := l.checkBan(host); err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	bucket := l.rpcs[host]
+	if bucket == nil {
+		bucket = newBucket(l.cfg.RPCRate, l.cfg.RPCBurst)
+		l.rpcs[host] = bucket
+	}
+	l.mu.Unlock()
+
+	if bucket.Allow() {
+		return nil
+	}
+	rateLimited.WithLabelValues("rpc_rate").Inc()
+	if err := l.violation(ctx, addr, "rpc_rate"); err != nil {
+		return err
+	}
+	return status.Error(codes.ResourceExhausted, "too many requests, slow down")
+}
+
+// violation records a protocol violation of the given kind from addr. Once
+// the address breaks the rules too often, it is banned and the returned
+// error says for how long.
+func (l *limiter) violation(ctx context.Context, addr string, kind string) error {
+	protocolViolations.WithLabelValues(kind).Inc()
+	if l.cfg.MaxViolations <= 0 {
+		return nil
+	}
+	host := addressHost(addr)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	violations := l.violations[host]
+	if violations == nil || now.Sub(violations.since) > l.cfg.ViolationWindow {
+		violations = &violationCount{since: now}
+		l.violations[host] = violations
+	}
+	if violations.count++; violations.count < l.cfg.MaxViolations {
+		return nil
+	}
+
+	delete(l.violations, host)
+	l.bannedUntil[host] = now.Add(l.cfg.BanDuration)
+	addressBans.Inc()
+	slog.WarnContext(ctx, "address banned for protocol violations", "host", host, "last_violation", kind, "duration", l.cfg.BanDuration)
+	return status.Errorf(codes.PermissionDenied, "too many protocol violations, your address is banned for %s", l.cfg.BanDuration)
+}
+
+// checkBan returns a PermissionDenied error if host is banned. The caller
+// must hold l.mu.
+func (l *limiter) checkBan(host string) error {
+	until, banned := l.bannedUntil[host]
+	if !banned {
+		return nil
+	}
+	if remaining := time.Until(until); remaining > 0 {
+		rateLimited.WithLabelValues("banned").Inc()
+		return status.Errorf(codes.PermissionDenied, "too many protocol violations from %s, try again in %s", host, remaining.Round(time.Second))
+	}
+	delete(l.bannedUntil, host)
+	return nil
+}
+
+// sweep forgets, every interval, the buckets that are full again and the
+// bans and violations that expired, so idle clients don't take memory.
+func (l *limiter) sweep(interval time.Duration) {
+	for range time.Tick(interval) {
+		now := time.Now()
+
+		l.mu.Lock()
+		for key, bucket := range l.players {
+			if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+				delete(l.players, key)
+			}
+		}
+		for key, bucket := range l.rpcs {
+			if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+				delete(l.rpcs, key)
+			}
+		}
+		for host, violations := range l.violations {
+			if now.Sub(violations.since) > l.cfg.ViolationWindow {
+				delete(l.violations, host)
+			}
+		}
+		for host, until := range l.bannedUntil {
+			if now.After(until) {
+				delete(l.bannedUntil, host)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// inputLimit applies the limits of a session to the input its stream
+// handles itself instead of passing it on as commands, like the login and
+// nick lines of telnet clients or WebSocket frames that aren't commands.
+// The session counts its commands in the same bucket.
+type inputLimit struct {
+	limits *limiter
+	addr   string
+	bucket *rate.Limiter
+}
+
+// inputStream is a stream that handles part of the client's input itself.
+type inputStream interface {
+	inputLimit() *inputLimit
+}
+
+func (l *limiter) newInputLimit(addr string) *inputLimit {
+	return &inputLimit{limits: l, addr: addr, bucket: l.newSessionBucket()}
+}
+
+// allow takes a token from the bucket, reporting whether the input can be
+// handled. When there is none left, the input counts as a violation of the
+// given kind, and the error says if that got the address banned.
+func (l *inputLimit) allow(ctx context.Context, kind string) (bool, error) {
+	if l.bucket.Allow() {
+		return true, nil
+	}
+	rateLimited.WithLabelValues(kind).Inc()
+	return false, l.limits.violation(ctx, l.addr, kind)
+}
+
+// reject counts invalid input as a violation of the given kind, once it
+// took its token like any other input.
+func (l *inputLimit) reject(ctx context.Context, kind string) error {
+	if ok, err := l.allow(ctx, "command_rate"); !ok {
+		return err
+	}
+	return l.limits.violation(ctx, l.addr, kind)
+}
+
+// banned ends a session whose client got its address banned, telling it
+// why like when an operator kicks a player.
+func banned(stream connect4.Connect4Game_GameSessionServer, err error) error {
+	stream.Send(&connect4.GameUpdate{Message: "Banned: " + status.Convert(err).Message() + "."})
+	return status.Error(codes.Aborted, status.Convert(err).Message())
+}
+
+// limitCommand checks a command received on a session against the limits,
+// and returns the kind of violation when the command must be dropped. The
+// client is told why.
+func (s *server) limitCommand(bucket *rate.Limiter, in *connect4.GameCommand, current *session, stream connect4.Connect4Game_GameSessionServer) string {
+	player, _ := playerFromContext(stream.Context())
+	if current != nil {
+		player = current.client.Nickname
+	}
+
+	switch {
+	case !bucket.Allow():
+		rateLimited.WithLabelValues("command_rate").Inc()
+		stream.Send(&connect4.GameUpdate{Message: "You are sending commands too fast. Slow down!"})
+		return "command_rate"
+	case player != "" && !s.limits.allowPlayer(player):
+		rateLimited.WithLabelValues("player_rate").Inc()
+		stream.Send(&connect4.GameUpdate{Message: "You are sending commands too fast. Slow down!"})
+		return "player_rate"
+	case !knownCommands[in.Command]:
+		stream.Send(&connect4.GameUpdate{Message: "Unknown command " + in.Command + "."})
+		return "unknown_command"
+	}
+	return ""
+}
+
+// unaryLimitInterceptor rate limits the unary RPCs of each address. Health
+// checks are left alone, so a banned orchestrator doesn't restart the server.
+func (s *server) unaryLimitInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return handler(ctx, req)
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if err := s.limits.allowRPC(ctx, p.Addr.String()); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+// isOversized reports whether a stream failed because the client sent a
+// message over the size limit.
+func isOversized(err error) bool {
+	return errors.Is(err, websocket.ErrReadLimit) || status.Code(err) == codes.ResourceExhausted
+}
+
+// addressHost returns the host of a host:port address, which identifies the
+// client in the limits.
+func addressHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newStrictTestServer returns a test server that bans an address on its
+// third violation, with room for two commands a second.
+func newStrictTestServer(t *testing.T) *server {
+	s := newTestServer(t)
+	s.limits = newLimiter(LimitsConfig{
+		CommandRate:     1,
+		CommandBurst:    2,
+		MaxMessageSize:  1 << 10,
+		MaxViolations:   3,
+		ViolationWindow: time.Minute,
+		BanDuration:     time.Minute,
+	})
+	return s
+}
+
+func TestTelnetLoginsAreLimited(t *testing.T) {
+	s := newStrictTestServer(t)
+
+	server, client := net.Pipe()
+	go s.handleTelnet(server)
+	defer client.Close()
+
+	// Logins are answered one by one, and the connection closes once the
+	// guesses got the address banned. The account doesn't exist, so the
+	// logins fail faster than the bucket refills
+	go func() {
+		for i := 0; i < 20; i++ {
+			if _, err := client.Write([]byte("login alice guess" + string(rune('a'+i)) + "\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	client.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var output strings.Builder
+	lines := bufio.NewScanner(client)
+	for lines.Scan() {
+		output.WriteString(lines.Text() + "\n")
+	}
+	if !strings.Contains(output.String(), "Banned:") {
+		t.Fatalf("the guesses weren't limited, the server wrote:\n%s", output.String())
+	}
+	if failed := strings.Count(output.String(), "Login failed"); failed > 3 {
+		t.Errorf("%d logins were tried, want about the burst of 2", failed)
+	}
+}
+
+func TestTelnetUnknownLinesAreViolations(t *testing.T) {
+	s := newStrictTestServer(t)
+
+	server, client := net.Pipe()
+	go s.handleTelnet(server)
+	defer client.Close()
+
+	go func() {
+		for i := 0; i < 20; i++ {
+			if _, err := client.Write([]byte("dance\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	client.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var output strings.Builder
+	lines := bufio.NewScanner(client)
+	for lines.Scan() {
+		output.WriteString(lines.Text() + "\n")
+	}
+	if !strings.Contains(output.String(), "Banned:") {
+		t.Fatalf("unknown lines weren't counted, the server wrote:\n%s", output.String())
+	}
+}
+
+func TestWebSocketBadFramesAreViolations(t *testing.T) {
+	s := newStrictTestServer(t)
+	httpServer := httptest.NewServer(s.serveWebSocket(&websocket.Upgrader{}))
+	defer httpServer.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("{not json")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) || !strings.Contains(err.Error(), "banned") {
+			t.Fatalf("got %v, want the session closed for a ban", err)
+		}
+		return
+	}
+}
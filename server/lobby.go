@@ -0,0 +1,32 @@
+package main
+
+import (
+	connect4 "github.com/danieljcksn/connect-four/proto"
+)
+
+// lobby describes the games on the server, for clients choosing one to join
+// or watch.
+func (s *server) lobby() *connect4.Lobby {
+	lobby := &connect4.Lobby{}
+	for _, g := range s.sortedGames() {
+		g.do(func() { lobby.Games = append(lobby.Games, g.summary()) })
+	}
+	return lobby
+}
+
+// summary describes the game for the lobby. It must run on the game's goroutine.
+func (g *game) summary() *connect4.GameSummary {
+	summary := &connect4.GameSummary{
+		GameId:             g.id,
+		WaitingForOpponent: g.isWaiting(),
+		GameOver:           g.gameOver,
+		Spectators:         int32(len(g.spectators)),
+		CreatedAt:          g.createdAt.Unix(),
+	}
+	for _, player := range g.players {
+		if player != nil {
+			summary.Players = append(summary.Players, player.Nickname)
+		}
+	}
+	return summary
+}
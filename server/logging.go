@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader carries the ID of a request, both as gRPC metadata and as
+// an HTTP header. An ID sent by the client is kept, so a request can be
+// followed across services.
+const requestIDHeader = "x-request-id"
+
+// newLogHandler builds the handler of the server's logs, in the given format
+// (text or json).
+func newLogHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	options := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return contextHandler{slog.NewJSONHandler(w, options)}
+	}
+	return contextHandler{slog.NewTextHandler(w, options)}
+}
+
+type logAttrsKey struct{}
+
+// withLogAttrs returns a context whose log entries carry the given
+// attributes, after the ones of ctx.
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	parent, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(parent[:len(parent):len(parent)], attrs...))
+}
+
+type requestLogKey struct{}
+
+// requestLog identifies the request a log entry was written for.
+type requestLog struct {
+	id     string
+	method string
+	player string // Set once the request is authenticated, by withPlayer
+}
+
+// withPlayer attaches the authenticated player to the context, and to the
+// logs of the request.
+func withPlayer(ctx context.Context, nickname string) context.Context {
+	if request, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		request.player = nickname
+	}
+	return context.WithValue(ctx, playerContextKey{}, nickname)
+}
+
+// contextHandler adds the request, player, attributes set with withLogAttrs
+// and trace to the entries logged with a context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	player, _ := playerFromContext(ctx)
+	if request, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		record.AddAttrs(slog.String("request_id", request.id), slog.String("method", request.method))
+		if player == "" {
+			player = request.player // The context of the interceptors predates authentication
+		}
+	}
+	if player != "" {
+		record.AddAttrs(slog.String("player", player))
+	}
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// startRequest gives the request an ID, taken from the client when it sent
+// one, and returns a context that logs it along with the method.
+func startRequest(ctx context.Context, id string, method string) (context.Context, *requestLog) {
+	if id == "" || len(id) > 64 {
+		id = newRequestID()
+	}
+	request := &requestLog{id: id, method: method}
+	return context.WithValue(ctx, requestLogKey{}, request), request
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(fmt.Sprintf("reading random request ID: %v", err))
+	}
+	return hex.EncodeToString(id)
+}
+
+// loggingUnaryInterceptor logs every unary RPC once it returns, and gives
+// it a request ID that is sent back in the response header.
+func loggingUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, request := startRequest(ctx, incomingRequestID(ctx), info.FullMethod)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, request.id))
+
+	start := time.Now()
+	res, err := handler(ctx, req)
+	logRPC(ctx, "rpc finished", err, time.Since(start))
+	return res, err
+}
+
+// loggingStreamInterceptor logs the start and the end of every streaming
+// RPC, and gives it a request ID that is sent back in the response header.
+func loggingStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, request := startRequest(ss.Context(), incomingRequestID(ss.Context()), info.FullMethod)
+	ss.SetHeader(metadata.Pairs(requestIDHeader, request.id))
+
+	slog.DebugContext(ctx, "stream started")
+	start := time.Now()
+	err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	logRPC(ctx, "stream finished", err, time.Since(start))
+	return err
+}
+
+func incomingRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(requestIDHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// logRPC logs the end of an RPC, as an error when the server failed it.
+func logRPC(ctx context.Context, msg string, err error, duration time.Duration) {
+	code := status.Code(err)
+
+	level := slog.LevelInfo
+	switch code {
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unimplemented:
+		level = slog.LevelError
+	}
+
+	args := []any{"code", code.String(), "duration", duration}
+	if err != nil {
+		args = append(args, "err", status.Convert(err).Message())
+	}
+	slog.Log(ctx, level, msg, args...)
+}
+
+// fatal logs an error that keeps the server from running and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// logRequests gives every HTTP request an ID, sent back in the
+// X-Request-Id header, and logs it once served.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, request := startRequest(r.Context(), r.Header.Get(requestIDHeader), r.Method+" "+r.URL.Path)
+		w.Header().Set(requestIDHeader, request.id)
+
+		start := time.Now()
+		next.ServeHTTP(w, r.WithContext(ctx))
+		slog.DebugContext(ctx, "http request finished", "ip", r.RemoteAddr, "duration", time.Since(start))
+	})
+}
@@ -1,39 +1,83 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"sync"
+	"syscall"
+	"time"
 
 	connect4 "github.com/danieljcksn/connect-four/proto"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
-type ClientInfo struct {
-	IP       string
-	Nickname string
-	Symbol   string
-
-	Stream connect4.Connect4Game_GameSessionServer // Store the stream reference, so we can broadcast messages to both clients later
-}
-
 type server struct {
 	connect4.UnimplementedConnect4GameServer
-	clients     map[string]ClientInfo // Track clients by IP and include their nickname
-	clientsLock sync.Mutex            // Ensure thread-safe access to clients
-	gameBoard   [ROWS][COLS]int32     // 6 rows, 7 columns
+	games     map[string]*game // Games being played or waiting for an opponent, by ID
+	gamesLock sync.Mutex       // Ensure thread-safe access to games
+
+	maxGames       int           // Maximum number of concurrent games, 0 for no limit
+	reconnectGrace time.Duration // How long the seat of a logged in player is kept after a disconnection
+
+	chatMaxLength int        // Characters per chat message
+	chatFilter    chatFilter // Applied to every chat message, e.g. to mask profanity
+
+	accounts *accountStore // Registered players
+	tokens   *tokenSigner  // Issues and verifies session tokens
 
-	currentPlayer int // Index of current player, 0 or 1
-	players       [2]string
+	reservedNicknames map[string]bool // Nicknames nobody can register, like the admins', by account key
+
+	bans   *banStore // Nicknames kept out by the operators
+	limits *limiter  // Rate limits and connection caps against abusive clients
+
+	sendQueueSize   int // Updates queued for a session
+	slowPlayerDrops int // Updates a player can miss in a row before it is disconnected
+
+	heartbeatInterval time.Duration // Between the pings sent to each client
+	heartbeatTimeout  time.Duration // Silence after which a session is ended
+
+	// No new game starts while the server drains on shutdown or is in
+	// maintenance. Guarded by gamesLock
+	draining           bool
+	maintenance        bool
+	maintenanceMessage string
 }
 
 const (
 	ROWS = 6
 	COLS = 7
+
+	accountsFile        = "accounts.json"
+	gamesCheckpointFile = "games.json" // Games in progress when the server was shut down
+
+	shutdownTimeout = 5 * time.Second // Time given to connections to close once the games are drained
 )
 
+// session is the seat a stream took in a game, or the game it watches.
+type session struct {
+	game   *game
+	seat   int // -1 for spectators
+	client *ClientInfo
+}
+
 func (s *server) GameSession(stream connect4.Connect4Game_GameSessionServer) error {
 	// Get the network information of the client
 	p, ok := peer.FromContext(stream.Context())
@@ -42,243 +86,659 @@ func (s *server) GameSession(stream connect4.Connect4Game_GameSessionServer) err
 		return fmt.Errorf("error retrieving peer information")
 	}
 
-	ipAddr := p.Addr.String()
-	s.clientsLock.Lock()
+	release, err := s.limits.connect(p.Addr.String())
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return s.handleClientCommands(stream, p.Addr.String())
+}
+
+// handleClientCommands processes commands from the client's stream.
+func (s *server) handleClientCommands(stream connect4.Connect4Game_GameSessionServer, ipAddr string) error {
+	clients := connectedClients.WithLabelValues(streamTransport(stream))
+	clients.Inc()
+	defer clients.Dec()
+
+	// Entries logged for the session carry the client, and its game once it joins one
+	ctx := withLogAttrs(stream.Context(), slog.String("ip", ipAddr))
+
+	// Commands are received in the background, so an operator can end the
+	// session while it waits for one
+	kick := make(chan string, 1)
 
-	if len(s.clients) >= 2 {
-		s.clientsLock.Unlock()
-		return fmt.Errorf("maximum number of clients reached")
+	commands := s.limits.newSessionBucket()
+	if input, ok := stream.(inputStream); ok {
+		commands = input.inputLimit().bucket
 	}
 
-	client, exists := s.clients[ipAddr]
+	// The updates, whether sent by the session or by the game, are queued
+	// and written in the background. The game leaves the session before the
+	// queue is closed
+	queue := s.newSendQueue(stream, kick)
+	defer queue.close()
+	stream = queue
+
+	var current *session
+	defer func() {
+		if current != nil {
+			s.handleDisconnect(current, stream)
+		}
+	}()
+
+	received := make(chan receivedCommand, 1)
+	receiving := false
+
+	// The client is pinged regularly. Once it has shown it answers, by
+	// sending a ping or a pong, the session ends when it stays silent for too
+	// long, so half-open connections don't hold seats. Clients that never
+	// answer, like grpcurl or telnet, are left to the keepalives of the
+	// connection
+	heartbeat := time.NewTicker(s.heartbeatInterval)
+	defer heartbeat.Stop()
+	lastReceived := time.Now()
+	checkLiveness := false
+	keepSession := keepsSession(queue.Connect4Game_GameSessionServer)
+
+	for {
+		if !receiving {
+			go func() {
+				in, err := stream.Recv()
+				received <- receivedCommand{in, err}
+			}()
+			receiving = true
+		}
+
+		// Spectators can't keep a game from being removed, and are told
+		// when it is
+		var gameRemoved <-chan struct{}
+		if current != nil && current.client.Spectator {
+			gameRemoved = current.game.stopped
+		}
+
+		var in *connect4.GameCommand
+		select {
+		case <-gameRemoved:
+			slog.InfoContext(ctx, "watched game removed")
+			stream.Send(gameClosed(current.game))
+			if !keepSession {
+				return nil
+			}
+			current = nil
+			queue.setSpectator(false)
+			continue
+		case message := <-kick:
+			slog.InfoContext(ctx, "client kicked", "message", message)
+			stream.Send(&connect4.GameUpdate{Message: message})
+			return status.Error(codes.Aborted, message)
+		case <-heartbeat.C:
+			if checkLiveness && time.Since(lastReceived) > s.heartbeatTimeout {
+				deadClients.Inc()
+				slog.InfoContext(ctx, "client timed out", "silent_for", time.Since(lastReceived).Round(time.Second))
+				return status.Error(codes.DeadlineExceeded, "the client stopped answering pings")
+			}
+			stream.Send(ping())
+			continue
+		case r := <-received:
+			receiving = false
+			if status.Code(r.err) == codes.PermissionDenied {
+				return banned(stream, r.err) // By the input the stream handles itself
+			}
+			if r.err != nil {
+				if r.err != io.EOF && status.Code(r.err) != codes.Canceled {
+					streamErrors.WithLabelValues("recv").Inc()
+				}
+				if isOversized(r.err) {
+					s.limits.violation(ctx, ipAddr, "message_too_large")
+				}
+				slog.InfoContext(ctx, "client disconnected", "err", r.err)
+				return nil
+			}
+			in = r.in
+			lastReceived = time.Now()
+		}
+
+		if violation := s.limitCommand(commands, in, current, stream); violation != "" {
+			if err := s.limits.violation(ctx, ipAddr, violation); err != nil {
+				return banned(stream, err)
+			}
+			continue
+		}
+		if handleHeartbeat(in, stream) {
+			checkLiveness = true
+			continue
+		}
+
+		slog.DebugContext(ctx, "command received", "command", in.Command, "column", in.Column)
 
-	if !exists {
-		client = ClientInfo{
-			IP:     ipAddr,
-			Stream: stream,
-			Symbol: chooseSymbol(len(s.clients)),
+		commandCtx, span := startCommandSpan(ctx, in, current)
+		joined, err := s.handleCommand(commandCtx, ipAddr, in, current, stream, kick)
+		endSpan(span, err)
+		if err != nil && keepSession {
+			stream.Send(&connect4.GameUpdate{Message: "Error: " + status.Convert(err).Message()})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if joined != nil {
+			current = joined
+			queue.setSpectator(joined.client.Spectator)
+			ctx = withLogAttrs(ctx, slog.String("game", joined.game.id), slog.String("nickname", joined.client.Nickname))
 		}
-		s.players[len(s.clients)] = ipAddr
-		s.clients[ipAddr] = client
 	}
+}
 
-	s.clientsLock.Unlock()
+type receivedCommand struct {
+	in  *connect4.GameCommand
+	err error
+}
 
-	return s.handleClientCommands(stream, ipAddr)
+// handleCommand runs a command received from a client, which is in the game
+// of current if it joined one. It returns the new session when the command
+// joins a game.
+func (s *server) handleCommand(ctx context.Context, ipAddr string, in *connect4.GameCommand, current *session, stream connect4.Connect4Game_GameSessionServer, kick chan string) (*session, error) {
+	switch in.Command {
+	case "connect", "create", "join", "spectate":
+		if current != nil {
+			stream.Send(&connect4.GameUpdate{Message: "You are already in game " + current.game.id + "."})
+			return nil, nil
+		}
+		return s.handleJoinCommand(ctx, ipAddr, in, stream, kick)
+	case "move":
+		switch {
+		case current == nil:
+			stream.Send(moveRejected("Join a game before making a move.", connect4.MoveRejected_WAITING_FOR_OPPONENT))
+			return nil, nil
+		case current.client.Spectator:
+			stream.Send(moveRejected("Spectators can't make moves.", connect4.MoveRejected_NOT_YOUR_TURN))
+			return nil, nil
+		}
+		current.game.handleMoveCommand(ctx, current.seat, in.Column)
+	case "resign":
+		if current == nil || current.client.Spectator {
+			stream.Send(moveRejected("There is no game in progress to resign.", connect4.MoveRejected_GAME_OVER))
+			return nil, nil
+		}
+		current.game.handleResignCommand(current.seat)
+	case "rematch":
+		if current == nil || current.client.Spectator {
+			stream.Send(&connect4.GameUpdate{Message: "Only the players of a game can ask for a rematch."})
+			return nil, nil
+		}
+		if err := s.checkNewGames(); err != nil {
+			stream.Send(&connect4.GameUpdate{Message: status.Convert(err).Message()})
+			return nil, nil
+		}
+		current.game.handleRematchCommand(current.seat)
+	case "list":
+		stream.Send(&connect4.GameUpdate{Event: &connect4.GameUpdate_Lobby{Lobby: s.lobby()}})
+	case "chat", "emote":
+		if current == nil {
+			stream.Send(&connect4.GameUpdate{Message: "Join a game before chatting."})
+			return nil, nil
+		}
+		s.handleChatCommand(current, in, stream)
+	}
+	return nil, nil
 }
 
-// handleClientCommands processes commands from the client's stream.
-func (s *server) handleClientCommands(stream connect4.Connect4Game_GameSessionServer, ipAddr string) error {
-	for {
-		in, err := stream.Recv()
-		if err != nil {
-			log.Printf("Failed to receive a message: %v", err)
-			break
+// handleJoinCommand seats the player at a game. Authenticated players always
+// play under their account's nickname, while guests can't take a nickname
+// that belongs to a registered account.
+func (s *server) handleJoinCommand(ctx context.Context, ipAddr string, in *connect4.GameCommand, stream connect4.Connect4Game_GameSessionServer, kick chan string) (*session, error) {
+	nickname, authenticated := playerFromContext(stream.Context())
+	if !authenticated {
+		var err error
+		if nickname, err = cleanNickname(in.Nickname); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
+		if s.accounts.IsRegistered(nickname) {
+			return nil, status.Errorf(codes.Unauthenticated, "the nickname %s is registered, please log in to use it", nickname)
+		}
+	}
+	if err := s.bans.Check(nickname); err != nil {
+		return nil, err
+	}
 
-		switch in.Command {
-		case "connect":
-			s.handleConnectCommand(ipAddr, in.Nickname, stream)
-		case "move":
-			s.handleMoveCommand(ipAddr, in.Column, stream)
+	client := &ClientInfo{IP: ipAddr, Nickname: nickname, Authenticated: authenticated, Stream: stream, kick: kick}
+	if in.Command == "spectate" {
+		watched, err := s.spectateGame(in.GameId, client)
+		if err != nil {
+			return nil, err
 		}
+
+		slog.InfoContext(ctx, "spectator connected", "nickname", nickname, "game", watched.game.id)
+		return watched, nil
 	}
 
-	s.clientsLock.Lock()
-	delete(s.clients, ipAddr)
-	s.clientsLock.Unlock()
+	joined, err := s.joinGame(in.Command, in.GameId, in.Options, client)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	slog.InfoContext(ctx, "player connected", "nickname", nickname, "game", joined.game.id, "symbol", client.Symbol)
+	return joined, nil
 }
 
-// handleConnectCommand processes the connect command from the client.
-func (s *server) handleConnectCommand(ipAddr string, nickname string, stream connect4.Connect4Game_GameSessionServer) {
-	s.clientsLock.Lock()
-	client := s.clients[ipAddr]
-	client.Nickname = nickname
-	s.clients[ipAddr] = client
-	s.clientsLock.Unlock()
-
-	fmt.Println(nickname, "connected from IP:", ipAddr, ". The player's symbol is:", client.Symbol)
-	stream.Send(&connect4.GameUpdate{Message: "Welcome to Connect Four, " + nickname + "!"})
+// spectateGame lets the client watch the game with the given ID.
+func (s *server) spectateGame(gameID string, client *ClientInfo) (*session, error) {
+	s.gamesLock.Lock()
+	g := s.games[gameID]
+	s.gamesLock.Unlock()
 
-	if len(s.clients) == 2 {
-		s.broadcast((nickname + " has joined the game!"), "You are now connected.", "", false)
-		s.broadcast("It's your turn!", "Waiting for "+s.clients[s.players[s.currentPlayer]].Nickname+" to make a move.", s.formatBoard(), false)
-	} else {
-		stream.Send(&connect4.GameUpdate{Message: "Just a second! Waiting for another player to connect"})
+	if g == nil || !g.do(func() { g.addSpectator(client) }) {
+		return nil, status.Errorf(codes.NotFound, "game %s not found", gameID)
 	}
+	return &session{game: g, seat: -1, client: client}, nil
 }
 
-// handleMoveCommand processes the move command from the client.
-func (s *server) handleMoveCommand(ipAddr string, column int32, stream connect4.Connect4Game_GameSessionServer) {
-	if len(s.clients) < 2 {
-		stream.Send(&connect4.GameUpdate{Message: "Just a second! Waiting for another player to connect."})
-		return
+// joinGame seats the client according to the command: "create" opens a new
+// game, "join" takes a seat at the game with the given ID and "connect" (or
+// "join" without an ID) picks the oldest game waiting for an opponent,
+// opening a new one when there is none. Games opened here use options.
+func (s *server) joinGame(command string, gameID string, options *connect4.GameOptions, client *ClientInfo) (*session, error) {
+	s.gamesLock.Lock()
+	defer s.gamesLock.Unlock()
+
+	var g *game
+	switch {
+	case command == "create":
+	case gameID != "":
+		if g = s.games[gameID]; g == nil {
+			return nil, status.Errorf(codes.NotFound, "game %s not found", gameID)
+		}
+	default:
+		g = s.oldestWaitingGame()
 	}
 
-	if s.players[s.currentPlayer] != ipAddr {
-		stream.Send(&connect4.GameUpdate{Message: "It's not your turn yet."})
-		return
+	if g == nil {
+		var err error
+		if g, err = s.openGame(options); err != nil {
+			return nil, err
+		}
 	}
 
-	if !s.isValidMove(column) {
-		stream.Send(&connect4.GameUpdate{Message: "Invalid move. Try again."})
-		return
+	// The game can't be removed while s.gamesLock is held
+	var joined *session
+	var err error
+	g.do(func() {
+		// Players can still come back to a game in progress
+		if err = s.newGameError(); err != nil && !g.started {
+			return
+		}
+
+		var seat int
+		if seat, err = g.seat(client); err == nil {
+			joined = &session{game: g, seat: seat, client: g.players[seat]}
+		}
+	})
+	return joined, err
+}
+
+// openGame adds a new game with the given options to the server. The caller
+// must hold s.gamesLock.
+func (s *server) openGame(options *connect4.GameOptions) (*game, error) {
+	if err := s.newGameError(); err != nil {
+		return nil, err
+	}
+	if s.maxGames > 0 && len(s.games) >= s.maxGames {
+		return nil, status.Error(codes.ResourceExhausted, "maximum number of games reached, try again later")
+	}
+	if err := validateGameOptions(options); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	s.applyMove(column, s.clients[ipAddr].Symbol)
-	winner := s.checkForWinner()
-	switch winner {
-	case "Tie":
-		s.broadcast("The game is a tie.", "The game is a tie.", s.formatBoard(), true)
-		return // End game session after a tie
-	case "":
-		s.switchPlayerTurn()
-		s.broadcast("It's your turn!", "Move accepted. "+s.clients[s.players[s.currentPlayer]].Nickname+"'s turn", s.formatBoard(), false)
-	default:
-		s.broadcast("Congratulations, "+s.clients[s.players[s.currentPlayer]].Nickname+"! You won!", "You lost. Better luck next time.", s.formatBoard(), true)
-		return // End game session after a win
+	g := newGame(options)
+	s.games[g.id] = g
+	activeGames.WithLabelValues(metricLabel(g.options.FirstMove.String())).Inc()
+	return g, nil
+}
+
+// oldestWaitingGame returns the game that has been waiting the longest for
+// an opponent, or nil. The caller must hold s.gamesLock.
+func (s *server) oldestWaitingGame() *game {
+	var oldest *game
+	for _, g := range s.games {
+		var waiting bool
+		g.do(func() { waiting = g.isWaiting() })
+
+		if waiting && (oldest == nil || g.createdAt.Before(oldest.createdAt)) {
+			oldest = g
+		}
 	}
+	return oldest
 }
 
-func (s *server) broadcast(activeMessage string, otherMessage string, board string, closeConnections bool) {
-	s.clientsLock.Lock()
-	defer s.clientsLock.Unlock()
+// handleDisconnect frees the seat of a stream that was closed. A logged in
+// player that leaves a game in progress has reconnectGrace to come back
+// before the opponent is given the win.
+func (s *server) handleDisconnect(current *session, stream connect4.Connect4Game_GameSessionServer) {
+	g := current.game
+	if current.client.Spectator {
+		g.removeSpectator(current.client)
+		return
+	}
 
-	for _, client := range s.clients {
-		if client.Stream != nil {
-			message := otherMessage
-			if client.IP == s.players[s.currentPlayer] {
-				message = activeMessage
+	var empty bool
+	g.do(func() {
+		client := g.players[current.seat]
+		if client == nil || client.Stream != stream {
+			return // The player already came back on a newer stream
+		}
+		client.Stream = nil
+
+		if g.gameOver {
+			// A rematch needs both players
+			g.rematchOffers = [2]bool{}
+			g.send(opponent(current.seat), &connect4.GameUpdate{Message: client.Nickname + " left the game."})
+		} else if g.started {
+			other := g.players[opponent(current.seat)]
+			switch {
+			case other.Stream == nil:
+				// Nobody is left to win the game
+				g.stopAbandonTimer()
+				g.gameOver = true
+			case client.Authenticated && s.reconnectGrace > 0:
+				g.send(opponent(current.seat), &connect4.GameUpdate{Message: fmt.Sprintf("%s disconnected. Waiting up to %s for them to come back.", client.Nickname, s.reconnectGrace)})
+
+				var timer *time.Timer
+				timer = time.AfterFunc(s.reconnectGrace, func() { s.expireSeat(g, current.seat, &timer) })
+				g.abandonTimer = timer
+			default:
+				g.abandon(current.seat)
 			}
+		} else {
+			// Nobody plays against the player yet, so the seat goes to the
+			// next one instead of being held by a client that left
+			g.players[current.seat] = nil
+		}
 
-			client.Stream.Send(&connect4.GameUpdate{Message: message, Board: board})
+		empty = g.isEmpty()
+	})
 
-			if closeConnections {
-				client.Stream.Context().Done() // Close the stream
-			}
+	if empty {
+		s.removeGame(g)
+	}
+}
+
+// expireSeat gives the win to the opponent of a player that didn't come back
+// in time. timer is only read on the game's goroutine, as it is set after
+// the timer starts.
+func (s *server) expireSeat(g *game, seat int, timer **time.Timer) {
+	var empty bool
+	g.do(func() {
+		if g.abandonTimer != *timer {
+			return // The player came back
+		}
+		g.abandonTimer = nil
+
+		if !g.gameOver {
+			g.abandon(seat)
 		}
+
+		empty = g.isEmpty()
+	})
+
+	if empty {
+		s.removeGame(g)
 	}
 }
 
-// Game logic functions and helpers
-func (s *server) isValidMove(column int32) bool {
-	return column >= 0 && column < COLS && s.gameBoard[0][column] == 0
+// removeGame discards a game nobody is playing anymore.
+func (s *server) removeGame(g *game) {
+	s.gamesLock.Lock()
+	defer s.gamesLock.Unlock()
+
+	var empty bool
+	g.do(func() { empty = g.isEmpty() })
+
+	if empty && s.games[g.id] == g {
+		delete(s.games, g.id)
+		g.stop()
+		activeGames.WithLabelValues(metricLabel(g.options.FirstMove.String())).Dec()
+		slog.Info("game removed", "game", g.id)
+	}
 }
 
-func (s *server) applyMove(column int32, symbol string) {
-	for i := ROWS - 1; i >= 0; i-- {
-		if s.gameBoard[i][column] == 0 {
-			playerMark := int32(1)
-			if symbol == "o" {
-				playerMark = 2
-			}
-			s.gameBoard[i][column] = playerMark
-			break
-		}
+// moveRejected builds the update that rejects a move, counting the
+// rejection.
+func moveRejected(message string, reason connect4.MoveRejected_Reason) *connect4.GameUpdate {
+	movesRejected.WithLabelValues(metricLabel(reason.String())).Inc()
+	return &connect4.GameUpdate{
+		Message: message,
+		Event:   &connect4.GameUpdate_MoveRejected{MoveRejected: &connect4.MoveRejected{Reason: reason}},
 	}
 }
 
-func (s *server) checkForWinner() string {
-	// Check rows for a 4-in-a-row
-	for i := 0; i < ROWS; i++ {
-		for j := 0; j < COLS-3; j++ {
-			if s.gameBoard[i][j] != 0 && s.gameBoard[i][j] == s.gameBoard[i][j+1] && s.gameBoard[i][j] == s.gameBoard[i][j+2] && s.gameBoard[i][j] == s.gameBoard[i][j+3] {
-				return s.clients[s.players[s.currentPlayer]].Nickname
-			}
-		}
+func main() {
+	cfg, printConfig, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("invalid configuration", err)
 	}
 
-	// Check columns for a 4-in-a-row
-	for j := 0; j < COLS; j++ {
-		for i := 0; i < ROWS-3; i++ {
-			if s.gameBoard[i][j] != 0 && s.gameBoard[i][j] == s.gameBoard[i+1][j] && s.gameBoard[i][j] == s.gameBoard[i+2][j] && s.gameBoard[i][j] == s.gameBoard[i+3][j] {
-				return s.clients[s.players[s.currentPlayer]].Nickname
-			}
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("failed to print configuration", err)
 		}
+		return
 	}
 
-	// Check positive diagonal for a 4-in-a-row
-	for i := 0; i < ROWS-3; i++ {
-		for j := 0; j < COLS-3; j++ {
-			if s.gameBoard[i][j] != 0 && s.gameBoard[i][j] == s.gameBoard[i+1][j+1] && s.gameBoard[i][j] == s.gameBoard[i+2][j+2] && s.gameBoard[i][j] == s.gameBoard[i+3][j+3] {
-				return s.clients[s.players[s.currentPlayer]].Nickname
-			}
-		}
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, cfg.LogFormat, cfg.logLevel())))
+
+	lis, err := net.Listen("tcp", cfg.ListenAddr)
+
+	if err != nil {
+		fatal("failed to listen", err)
 	}
 
-	// Check negative diagonal for a 4-in-a-row
-	for i := 0; i < ROWS-3; i++ {
-		for j := 3; j < COLS; j++ {
-			if s.gameBoard[i][j] != 0 && s.gameBoard[i][j] == s.gameBoard[i+1][j-1] && s.gameBoard[i][j] == s.gameBoard[i+2][j-2] && s.gameBoard[i][j] == s.gameBoard[i+3][j-3] {
-				return s.clients[s.players[s.currentPlayer]].Nickname
-			}
-		}
+	accounts, err := newAccountStore(filepath.Join(cfg.StoragePath, accountsFile))
+	if err != nil {
+		fatal("failed to load accounts", err)
 	}
 
-	// Check for a tie (no empty spaces left)
-	for i := 0; i < ROWS; i++ {
-		for j := 0; j < COLS; j++ {
-			if s.gameBoard[i][j] == 0 {
-				return ""
-			}
+	tokens, err := newTokenSigner([]byte(cfg.Auth.TokenSecret), cfg.Auth.TokenTTL)
+	if err != nil {
+		fatal("failed to create token signer", err)
+	}
+
+	bans, err := newBanStore(filepath.Join(cfg.StoragePath, bansFile))
+	if err != nil {
+		fatal("failed to load bans", err)
+	}
+
+	audit, err := newAuditLog(filepath.Join(cfg.StoragePath, auditLogFile))
+	if err != nil {
+		fatal("failed to open audit log", err)
+	}
+
+	gameServer := &server{
+		games:          make(map[string]*game),
+		maxGames:       cfg.MaxGames,
+		reconnectGrace: cfg.ReconnectGrace,
+		chatMaxLength:  cfg.Chat.MaxLength,
+		chatFilter:     maskWords(cfg.Chat.BlockedWords),
+		accounts:       accounts,
+		tokens:         tokens,
+		bans:           bans,
+		limits:         newLimiter(cfg.Limits),
+
+		sendQueueSize:     cfg.Streams.SendQueueSize,
+		slowPlayerDrops:   cfg.Streams.SlowPlayerDrops,
+		heartbeatInterval: cfg.Streams.HeartbeatInterval,
+		heartbeatTimeout:  cfg.Streams.HeartbeatTimeout,
+	}
+	admin := newAdminServer(gameServer, cfg.Admin.Players, audit)
+
+	gameServer.registerGameMetrics()
+
+	checkpointPath := filepath.Join(cfg.StoragePath, gamesCheckpointFile)
+	restored, err := gameServer.restore(checkpointPath)
+	if err != nil {
+		fatal("failed to restore games", err)
+	}
+	if restored > 0 {
+		slog.Info("games restored", "games", restored, "grace", cfg.ReconnectGrace)
+	}
+
+	shutdownTracing, err := setupTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	go gameServer.limits.sweep(time.Minute)
+
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.MaxRecvMsgSize(cfg.Limits.MaxMessageSize),
+		grpc.ChainUnaryInterceptor(metricsUnaryInterceptor, loggingUnaryInterceptor, gameServer.unaryLimitInterceptor, gameServer.unaryAuthInterceptor, admin.unaryInterceptor),
+		grpc.ChainStreamInterceptor(metricsStreamInterceptor, loggingStreamInterceptor, gameServer.streamAuthInterceptor),
+	}
+	opts = append(opts, keepaliveOptions(cfg.Streams)...)
+
+	var tlsConfig *tls.Config
+	if cfg.TLS.Cert != "" {
+		tlsConfig, err = serverTLSConfig(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.ClientCA, cfg.TLS.RequireClientCert)
+		if err != nil {
+			fatal("failed to configure TLS", err)
 		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
 
-	return "Tie" // If no empty cells and no winner, it's a tie
-}
+	s := grpc.NewServer(opts...)
+	connect4.RegisterConnect4GameServer(s, gameServer)
+	connect4.RegisterAdminServer(s, admin)
 
-func (s *server) switchPlayerTurn() {
-	s.currentPlayer ^= 1 // Toggle between 0 and 1 using XOR
-}
+	// The health of the game service is also the health of the server ("")
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(connect4.Connect4Game_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(connect4.Admin_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	if cfg.Reflection {
+		reflection.Register(s)
+	}
+
+	var httpServer *http.Server
+	if cfg.HTTP.ListenAddr != "" {
+		httpLis, err := net.Listen("tcp", cfg.HTTP.ListenAddr)
+		if err != nil {
+			fatal("failed to listen for HTTP", err)
+		}
 
-// Formatting functions
-func (s *server) formatBoard() string {
-	var boardStr string
-	for i := 0; i < ROWS; i++ {
-		for j := 0; j < COLS; j++ {
-			cellSymbol := getCellSymbol(s.gameBoard[i][j])
-			boardStr += fmt.Sprintf("[%s]", cellSymbol)
+		httpServer, err = newHTTPServer(cfg, gameServer, tlsConfig)
+		if err != nil {
+			fatal("failed to create HTTP server", err)
 		}
-		boardStr += "\n"
+		go func() {
+			var err error
+			if tlsConfig != nil {
+				err = httpServer.ServeTLS(httpLis, "", "")
+			} else {
+				err = httpServer.Serve(httpLis)
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				fatal("failed to serve HTTP", err)
+			}
+		}()
+
+		slog.Info("http server started", "addr", httpLis.Addr().String())
 	}
-	return boardStr
-}
 
-func chooseSymbol(numClients int) string {
-	if numClients == 0 {
-		return "x"
+	var metricsServer *http.Server
+	if cfg.Metrics.ListenAddr != "" {
+		metricsLis, err := net.Listen("tcp", cfg.Metrics.ListenAddr)
+		if err != nil {
+			fatal("failed to listen for metrics", err)
+		}
+
+		metricsServer = newMetricsServer(cfg.Metrics)
+		go func() {
+			if err := metricsServer.Serve(metricsLis); !errors.Is(err, http.ErrServerClosed) {
+				fatal("failed to serve metrics", err)
+			}
+		}()
+
+		slog.Info("metrics server started", "addr", metricsLis.Addr().String())
 	}
-	return "o"
-}
 
-func getCellSymbol(value int32) string {
-	switch value {
-	case 0:
-		return " "
-	case 1:
-		return "x"
-	case 2:
-		return "o"
-	default:
-		return "?"
+	var telnetLis net.Listener
+	if cfg.Telnet.ListenAddr != "" {
+		telnetLis, err = net.Listen("tcp", cfg.Telnet.ListenAddr)
+		if err != nil {
+			fatal("failed to listen for telnet", err)
+		}
+
+		go func() {
+			if err := gameServer.serveTelnet(telnetLis); !errors.Is(err, net.ErrClosed) {
+				fatal("failed to serve telnet", err)
+			}
+		}()
+
+		slog.Info("telnet server started", "addr", telnetLis.Addr().String())
 	}
-}
 
-func main() {
-	lis, err := net.Listen("tcp", ":50051")
+	slog.Info("server started", "addr", lis.Addr().String(), "tls", cfg.TLS.Cert != "", "reflection", cfg.Reflection)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			fatal("failed to serve", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop() // A second signal kills the server right away
+
+	slog.Info("shutting down", "drain", cfg.ShutdownDrain)
+	healthServer.Shutdown()
+	gameServer.drain(cfg.ShutdownDrain)
+
+	saved, err := gameServer.checkpoint(checkpointPath)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		slog.Error("failed to save the games in progress", "err", err)
+	}
+	if saved > 0 {
+		slog.Info("games saved", "games", saved, "path", checkpointPath)
 	}
 
-	s := grpc.NewServer()
-	connect4.RegisterConnect4GameServer(s, &server{clients: make(map[string]ClientInfo)})
+	if telnetLis != nil {
+		telnetLis.Close()
+	}
+	if httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			httpServer.Close() // Event streams don't end by themselves
+		}
+		cancel()
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+
+	// Game sessions are long lived streams, so they are cut after a moment
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		s.Stop()
+	}
 
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "err", err)
 	}
+	cancel()
 
-	print("Server started on port 50051")
+	slog.Info("server stopped")
 }
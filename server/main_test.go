@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestServer returns a server configured like by default, with its
+// files in a temporary directory and without the rate limits.
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	cfg := defaultConfig()
+	dir := t.TempDir()
+
+	accounts, err := newAccountStore(filepath.Join(dir, accountsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := newTokenSigner([]byte("0123456789abcdef"), cfg.Auth.TokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bans, err := newBanStore(filepath.Join(dir, bansFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &server{
+		games:          make(map[string]*game),
+		reconnectGrace: cfg.ReconnectGrace,
+		chatMaxLength:  cfg.Chat.MaxLength,
+		chatFilter:     maskWords(nil),
+		accounts:       accounts,
+		tokens:         tokens,
+		bans:           bans,
+		limits:         newLimiter(LimitsConfig{MaxMessageSize: cfg.Limits.MaxMessageSize}),
+
+		sendQueueSize:     cfg.Streams.SendQueueSize,
+		slowPlayerDrops:   cfg.Streams.SlowPlayerDrops,
+		heartbeatInterval: cfg.Streams.HeartbeatInterval,
+		heartbeatTimeout:  cfg.Streams.HeartbeatTimeout,
+	}
+}
+
+// dialTestServer serves s over an in-memory connection and returns a
+// client of it.
+func dialTestServer(t *testing.T, s *server) connect4.Connect4GameClient {
+	t.Helper()
+	return connect4.NewConnect4GameClient(serveTestServer(t, s, nil))
+}
+
+// serveTestServer serves s, along with admin unless it is nil, over an
+// in-memory connection and returns a connection to it.
+func serveTestServer(t *testing.T, s *server, admin *adminServer) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	unary := []grpc.UnaryServerInterceptor{s.unaryAuthInterceptor}
+	if admin != nil {
+		unary = append(unary, admin.unaryInterceptor)
+	}
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(s.streamAuthInterceptor),
+	)
+	connect4.RegisterConnect4GameServer(grpcServer, s)
+	if admin != nil {
+		connect4.RegisterAdminServer(grpcServer, admin)
+	}
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// gameCount returns the number of games on the server.
+func (s *server) gameCount() int {
+	s.gamesLock.Lock()
+	defer s.gamesLock.Unlock()
+	return len(s.games)
+}
+
+// connectionCount returns the number of sessions open on the server.
+func (l *limiter) connectionCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := 0
+	for _, connections := range l.connections {
+		count += connections
+	}
+	return count
+}
+
+// testStream is a game session stream that keeps the updates sent to it.
+type testStream struct {
+	grpc.ServerStream
+
+	ctx     context.Context
+	updates chan *connect4.GameUpdate
+}
+
+func newTestStream() *testStream {
+	return &testStream{ctx: context.Background(), updates: make(chan *connect4.GameUpdate, 100)}
+}
+
+func (t *testStream) Context() context.Context {
+	return t.ctx
+}
+
+func (t *testStream) Send(update *connect4.GameUpdate) error {
+	select {
+	case t.updates <- update:
+	default: // Nobody reads them
+	}
+	return nil
+}
+
+func (t *testStream) Recv() (*connect4.GameCommand, error) {
+	<-t.ctx.Done()
+	return nil, io.EOF
+}
+
+func TestLeavingUnstartedGameFreesSeat(t *testing.T) {
+	s := &server{games: make(map[string]*game)}
+
+	// The game isn't on the server, so it is kept after the player leaves,
+	// like when another player joins it before it is removed
+	g := newGame(nil)
+	defer g.stop()
+
+	alice := &ClientInfo{Nickname: "alice", Stream: newTestStream()}
+	var seat int
+	var err error
+	g.do(func() { seat, err = g.seat(alice) })
+	if err != nil {
+		t.Fatalf("seating alice: %v", err)
+	}
+	s.handleDisconnect(&session{game: g, seat: seat, client: alice}, alice.Stream)
+
+	bob := &ClientInfo{Nickname: "bob", Stream: newTestStream()}
+	var started bool
+	g.do(func() {
+		seat, err = g.seat(bob)
+		started = g.started
+	})
+	if err != nil {
+		t.Fatalf("seating bob: %v", err)
+	}
+	if started {
+		t.Fatal("the game started against a player that left")
+	}
+	if seat != 0 {
+		t.Errorf("bob took seat %d, want the freed seat 0", seat)
+	}
+}
+
+func TestNewConnectionTakesOverSeat(t *testing.T) {
+	s := &server{games: make(map[string]*game)}
+	g := newGame(nil)
+	defer g.stop()
+
+	oldKick := make(chan string, 1)
+	alice := &ClientInfo{Nickname: "alice", Authenticated: true, Stream: newTestStream(), kick: oldKick}
+	bob := &ClientInfo{Nickname: "bob", Stream: newTestStream()}
+	var seat int
+	var err error
+	g.do(func() {
+		if seat, err = g.seat(alice); err == nil {
+			_, err = g.seat(bob)
+		}
+	})
+	if err != nil {
+		t.Fatalf("seating the players: %v", err)
+	}
+	oldStream := alice.Stream
+
+	// Alice's connection dropped without the server noticing, and she
+	// joins again on a new one
+	again := &ClientInfo{Nickname: "alice", Authenticated: true, Stream: newTestStream(), kick: make(chan string, 1)}
+	var reclaimed int
+	g.do(func() { reclaimed, err = g.seat(again) })
+	if err != nil {
+		t.Fatalf("joining again: %v", err)
+	}
+	if reclaimed != seat {
+		t.Errorf("alice got seat %d back, want %d", reclaimed, seat)
+	}
+	select {
+	case <-oldKick:
+	default:
+		t.Error("the old session of alice wasn't ended")
+	}
+
+	// The old session ending doesn't take the seat from the new one
+	s.handleDisconnect(&session{game: g, seat: seat, client: alice}, oldStream)
+	var stream connect4.Connect4Game_GameSessionServer
+	g.do(func() { stream = g.players[seat].Stream })
+	if stream != again.Stream {
+		t.Error("the seat isn't held by the new connection")
+	}
+
+	// Someone else with the nickname but without logging in can't take it
+	impostor := &ClientInfo{Nickname: "alice", Stream: newTestStream(), kick: make(chan string, 1)}
+	g.do(func() { _, err = g.seat(impostor) })
+	if err == nil {
+		t.Error("a guest took the seat of a logged in player")
+	}
+}
+
+// openTestGame creates a game as a guest and returns its ID and the stream
+// of its creator.
+func openTestGame(t *testing.T, ctx context.Context, client connect4.Connect4GameClient) (string, connect4.Connect4Game_GameSessionClient) {
+	t.Helper()
+	creator, err := client.GameSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator.Send(&connect4.GameCommand{Command: "create", Nickname: "alice"})
+	welcome, err := creator.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return welcome.GetWelcome().GetGameId(), creator
+}
+
+func TestSpectatorsLeaveRemovedGame(t *testing.T) {
+	s := newTestServer(t)
+	client := dialTestServer(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	gameID, creator := openTestGame(t, ctx, client)
+	spectator, err := client.GameSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spectator.Send(&connect4.GameCommand{Command: "spectate", Nickname: "bob", GameId: gameID})
+	if update, err := spectator.Recv(); err != nil || update.GetWelcome() == nil {
+		t.Fatalf("spectating: %v, %v", update, err)
+	}
+
+	creator.CloseSend()
+	var closed bool
+	for {
+		update, err := spectator.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("the session ended with %v, want it closed by the server", err)
+		}
+		closed = closed || update.GetGameClosed().GetGameId() == gameID
+	}
+	if !closed {
+		t.Error("the spectator wasn't told that the game was closed")
+	}
+}
+
+// TestConcurrentSessions plays many sessions at once, joining, moving,
+// chatting, asking for rematches, listing and watching games and leaving at
+// random, and checks that every game is removed once they are all gone.
+// Run it with -race.
+func TestConcurrentSessions(t *testing.T) {
+	s := newTestServer(t)
+	client := dialTestServer(t, s)
+
+	const rounds, players, spectators = 3, 40, 10
+
+	var wg sync.WaitGroup
+	for round := 0; round < rounds; round++ {
+		for i := 0; i < players; i++ {
+			wg.Add(1)
+			go func(nickname string) {
+				defer wg.Done()
+				playSession(t, client, &connect4.GameCommand{Command: "connect", Nickname: nickname})
+			}(fmt.Sprintf("p%d_%d", round, i))
+		}
+		for i := 0; i < spectators; i++ {
+			wg.Add(1)
+			go func(nickname string) {
+				defer wg.Done()
+				lobby, err := client.ListGames(context.Background(), &connect4.ListGamesRequest{})
+				if err != nil || len(lobby.Games) == 0 {
+					return
+				}
+				gameID := lobby.Games[rand.Intn(len(lobby.Games))].GameId
+				playSession(t, client, &connect4.GameCommand{Command: "spectate", Nickname: nickname, GameId: gameID})
+			}(fmt.Sprintf("s%d_%d", round, i))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.gameCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d games left after every session ended", s.gameCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// playSession sends join, answering the updates with moves, chat, lobby
+// requests and rematches, until it leaves the game after a random time,
+// either closing the stream or dropping the connection.
+func playSession(t *testing.T, client connect4.Connect4GameClient, join *connect4.GameCommand) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(200+rand.Intn(800))*time.Millisecond)
+	defer cancel()
+
+	stream, err := client.GameSession(ctx)
+	if err != nil {
+		t.Errorf("opening a session: %v", err)
+		return
+	}
+	stream.Send(join)
+
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			return
+		}
+
+		switch {
+		case update.GetTurnChanged().GetYourTurn():
+			stream.Send(&connect4.GameCommand{Command: "move", Column: int32(rand.Intn(COLS))})
+		case update.GetGameOver() != nil:
+			stream.Send(&connect4.GameCommand{Command: "rematch"})
+		}
+		switch rand.Intn(8) {
+		case 0:
+			stream.Send(&connect4.GameCommand{Command: "chat", Text: "hi"})
+		case 1:
+			stream.Send(&connect4.GameCommand{Command: "list"})
+		case 2:
+			stream.Send(&connect4.GameCommand{Command: "move", Column: int32(rand.Intn(COLS))}) // Maybe out of turn
+		case 3:
+			if rand.Intn(4) == 0 {
+				stream.CloseSend()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics of the server, exposed at /metrics on the HTTP server.
+var (
+	connectedClients = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "connect4_connected_clients",
+		Help: "Open game sessions, by transport (grpc, websocket, telnet or sse).",
+	}, []string{"transport"})
+
+	activeGames = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "connect4_active_games",
+		Help: "Games on the server, by first move rule.",
+	}, []string{"first_move"})
+
+	gamesFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connect4_games_finished_total",
+		Help: "Games that ended, by reason (four_in_a_row, board_full, resignation, abandoned, ended_by_operator or aborted).",
+	}, []string{"reason"})
+
+	movesPlayed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "connect4_moves_total",
+		Help: "Moves accepted.",
+	})
+
+	movesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connect4_moves_rejected_total",
+		Help: "Moves and resignations rejected, by reason.",
+	}, []string{"reason"})
+
+	streamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connect4_stream_errors_total",
+		Help: "Game session streams that failed to send an update or receive a command.",
+	}, []string{"op"})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connect4_rate_limited_total",
+		Help: "Commands, RPCs and connections refused by the limits, by limit (command_rate, login_rate, player_rate, rpc_rate, connections_per_ip or banned).",
+	}, []string{"limit"})
+
+	protocolViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connect4_protocol_violations_total",
+		Help: "Protocol violations, by kind (command_rate, login_rate, player_rate, rpc_rate, unknown_command, bad_frame or message_too_large).",
+	}, []string{"kind"})
+
+	addressBans = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "connect4_address_bans_total",
+		Help: "Addresses banned for a while after too many protocol violations.",
+	})
+
+	queuedUpdates = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "connect4_send_queue_updates",
+		Help: "Updates waiting in the send queues of the sessions, by transport.",
+	}, []string{"transport"})
+
+	sendQueueDepth = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "connect4_send_queue_depth",
+		Help:    "Updates in the send queue of a session right after one is queued.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 9), // 1 to 256
+	})
+
+	droppedUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "connect4_dropped_updates_total",
+		Help: "Updates never written to a session, by reason (spectator_queue_full, player_queue_full or send_failed).",
+	}, []string{"reason"})
+
+	slowClientsDisconnected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "connect4_slow_clients_disconnected_total",
+		Help: "Players disconnected for missing too many updates.",
+	})
+
+	heartbeatRoundTrip = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "connect4_heartbeat_round_trip_seconds",
+		Help:    "Time clients took to answer the pings of the server.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12), // 1ms to about 2s
+	})
+
+	deadClients = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "connect4_dead_clients_total",
+		Help: "Game sessions ended because the client stopped answering pings.",
+	})
+
+	matchmakingWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "connect4_matchmaking_wait_seconds",
+		Help:    "Time the first player of a game waited for an opponent.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10), // 1s to about 8.5 minutes
+	})
+
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "connect4_grpc_request_duration_seconds",
+		Help:    "Duration of unary RPCs, by method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	streamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "connect4_grpc_stream_duration_seconds",
+		Help:    "Duration of streaming RPCs, by method and status code.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8), // 1s to about 4.5 hours
+	}, []string{"method", "code"})
+)
+
+// registerGameMetrics adds the metrics computed from the games on the server
+// when they are scraped.
+func (s *server) registerGameMetrics() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "connect4_matchmaking_queue_length",
+		Help: "Games waiting for an opponent.",
+	}, func() float64 {
+		waiting := 0
+		for _, summary := range s.lobby().Games {
+			if summary.WaitingForOpponent {
+				waiting++
+			}
+		}
+		return float64(waiting)
+	})
+}
+
+// metricsUnaryInterceptor measures the duration of every unary RPC.
+func metricsUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	res, err := handler(ctx, req)
+	rpcDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+	return res, err
+}
+
+// metricsStreamInterceptor measures the duration of every streaming RPC.
+func metricsStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	streamDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// streamTransport names the transport of a game session stream, for metrics.
+func streamTransport(stream connect4.Connect4Game_GameSessionServer) string {
+	switch stream := stream.(type) {
+	case *sendQueue:
+		return streamTransport(stream.Connect4Game_GameSessionServer)
+	case *wsStream:
+		return "websocket"
+	case *telnetStream:
+		return "telnet"
+	case *sseStream:
+		return "sse"
+	}
+	return "grpc"
+}
+
+// metricLabel turns an enum value name into a label value, e.g.
+// FOUR_IN_A_ROW into four_in_a_row.
+func metricLabel(name string) string {
+	return strings.ToLower(name)
+}
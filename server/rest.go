@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// unclaimedGameTimeout is how long a game opened by CreateGame waits for its
+// first player before it is discarded.
+const unclaimedGameTimeout = 5 * time.Minute
+
+// newGateway serves the unary RPCs annotated in service.proto as a REST API
+// with JSON bodies, e.g. GET /v1/games for ListGames. The RPCs are called in
+// process, without the gRPC interceptors, so the gateway authenticates the
+// requests itself.
+func (s *server) newGateway() (http.Handler, error) {
+	marshaler := &runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+	mux := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, marshaler))
+	if err := connect4.RegisterConnect4GameHandlerServer(context.Background(), mux, s); err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The REST API shares the limits of the unary RPCs
+		if err := s.limits.allowRPC(r.Context(), r.RemoteAddr); err != nil {
+			runtime.HTTPError(r.Context(), mux, marshaler, w, r, err)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, int64(s.limits.cfg.MaxMessageSize))
+
+		// Like Register and Login over gRPC, creating an account and logging
+		// in work with an expired token
+		if r.Method == http.MethodPost && (r.URL.Path == "/v1/accounts" || r.URL.Path == "/v1/sessions") {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, err := s.authenticate(grpcContext(r))
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, marshaler, w, r, err)
+			return
+		}
+		if nickname, ok := playerFromContext(ctx); ok {
+			r = r.WithContext(withPlayer(r.Context(), nickname))
+		}
+		mux.ServeHTTP(w, r)
+	}), nil
+}
+
+// serveOpenAPI serves the description of the REST API.
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(connect4.OpenAPI)
+}
+
+// ListGames describes the games on the server.
+func (s *server) ListGames(ctx context.Context, req *connect4.ListGamesRequest) (*connect4.Lobby, error) {
+	return s.lobby(), nil
+}
+
+// CreateGame opens a game for players to join by its ID.
+func (s *server) CreateGame(ctx context.Context, req *connect4.CreateGameRequest) (*connect4.GameSummary, error) {
+	s.gamesLock.Lock()
+	g, err := s.openGame(req.Options)
+	s.gamesLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Nobody holds a seat yet, so the game is only discarded when it stays
+	// empty
+	time.AfterFunc(unclaimedGameTimeout, func() { s.removeGame(g) })
+
+	slog.InfoContext(ctx, "game created", "game", g.id)
+
+	var summary *connect4.GameSummary
+	if !g.do(func() { summary = g.summary() }) {
+		return nil, status.Errorf(codes.NotFound, "game %s not found", g.id)
+	}
+	return summary, nil
+}
+
+// GetGame returns the record of the game with the given ID.
+func (s *server) GetGame(ctx context.Context, req *connect4.GetGameRequest) (*connect4.GameRecord, error) {
+	s.gamesLock.Lock()
+	g := s.games[req.GameId]
+	s.gamesLock.Unlock()
+
+	var record *connect4.GameRecord
+	if g == nil || !g.do(func() { record = g.record() }) {
+		return nil, status.Errorf(codes.NotFound, "game %s not found", req.GameId)
+	}
+	return record, nil
+}
+
+// GetPlayer returns the account of a player and the games it is seated at.
+func (s *server) GetPlayer(ctx context.Context, req *connect4.GetPlayerRequest) (*connect4.PlayerProfile, error) {
+	profile := &connect4.PlayerProfile{Nickname: req.Nickname}
+	if account, ok := s.accounts.Lookup(req.Nickname); ok {
+		profile.Nickname = account.Nickname
+		profile.Registered = true
+		profile.RegisteredAt = account.CreatedAt.Unix()
+	}
+
+	for _, summary := range s.lobby().Games {
+		if slices.ContainsFunc(summary.Players, func(nickname string) bool { return accountKey(nickname) == accountKey(req.Nickname) }) {
+			profile.Games = append(profile.Games, summary)
+		}
+	}
+
+	if !profile.Registered && len(profile.Games) == 0 {
+		return nil, status.Errorf(codes.NotFound, "player %s not found", req.Nickname)
+	}
+	return profile, nil
+}
+
+// record describes the game for GetGame. It must run on the game's goroutine.
+func (g *game) record() *connect4.GameRecord {
+	record := &connect4.GameRecord{
+		Summary: g.summary(),
+		Options: g.options,
+		Board:   g.formatBoard(),
+		Moves:   slices.Clone(g.moves),
+		Result:  g.result,
+	}
+	if g.started {
+		record.Series = g.series()
+		if !g.gameOver {
+			record.CurrentPlayer = g.players[g.currentPlayer].Nickname
+		}
+	}
+	return record
+}
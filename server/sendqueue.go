@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sendQueueFlushTimeout is how long a session that ends waits for the
+// updates still queued, e.g. the reason it was kicked, to be written. It is
+// longer than the write deadline of WebSocket, event stream and telnet
+// connections, so a client stuck on a write fails it before the session
+// gives up on the writer.
+const sendQueueFlushTimeout = wsWriteTimeout + 5*time.Second
+
+// sendQueue is a game session stream whose updates are queued and written by
+// a goroutine of its own, so a slow or stuck client never holds up its game
+// or the other clients. Send never blocks: when the queue is full, a
+// spectator misses the update, and a player that missed too many in a row
+// is disconnected.
+type sendQueue struct {
+	connect4.Connect4Game_GameSessionServer // The stream the updates are written to
+
+	slowPlayerDrops int32        // Updates a player can miss in a row before it is disconnected
+	kick            chan string  // Ends the session, nil when it can't be ended, like for event streams
+	spectator       atomic.Bool  // Set once the session watches a game
+	dropped         atomic.Int32 // Updates missed since the last one queued
+
+	queued prometheus.Gauge
+
+	mu     sync.Mutex // Guards closed and closing the queue
+	closed bool
+	queue  chan *connect4.GameUpdate
+	done   chan struct{} // Closed once the writer returns
+}
+
+// newSendQueue starts writing the updates sent on the returned stream to
+// stream. close must be called once the session ends.
+func (s *server) newSendQueue(stream connect4.Connect4Game_GameSessionServer, kick chan string) *sendQueue {
+	q := &sendQueue{
+		Connect4Game_GameSessionServer: stream,
+		slowPlayerDrops:                int32(s.slowPlayerDrops),
+		kick:                           kick,
+		queued:                         queuedUpdates.WithLabelValues(streamTransport(stream)),
+		queue:                          make(chan *connect4.GameUpdate, s.sendQueueSize),
+		done:                           make(chan struct{}),
+	}
+	go q.write()
+	return q
+}
+
+// Send queues an update for the client.
+func (q *sendQueue) Send(update *connect4.GameUpdate) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return io.ErrClosedPipe
+	}
+	select {
+	case q.queue <- update:
+		q.dropped.Store(0) // The client caught up
+		q.queued.Inc()
+		sendQueueDepth.Observe(float64(len(q.queue)))
+		return nil
+	default:
+	}
+
+	if q.spectator.Load() {
+		droppedUpdates.WithLabelValues("spectator_queue_full").Inc()
+		return nil
+	}
+	droppedUpdates.WithLabelValues("player_queue_full").Inc()
+	if q.dropped.Add(1) == q.slowPlayerDrops {
+		slowClientsDisconnected.Inc()
+		q.disconnect("Disconnected: your connection is too slow to keep up with the game.")
+	}
+	return nil
+}
+
+// setSpectator makes the client miss the updates that don't fit in its
+// queue instead of being disconnected, as watching a game can do without
+// some of them.
+func (q *sendQueue) setSpectator(spectator bool) {
+	q.spectator.Store(spectator)
+}
+
+// write writes the queued updates until the queue is closed. Once a write
+// fails the session is ended, and the remaining updates are discarded.
+func (q *sendQueue) write() {
+	defer close(q.done)
+
+	failed := false
+	for update := range q.queue {
+		q.queued.Dec()
+		if failed {
+			droppedUpdates.WithLabelValues("send_failed").Inc()
+			continue
+		}
+		if err := q.Connect4Game_GameSessionServer.Send(update); err != nil {
+			streamErrors.WithLabelValues("send").Inc()
+			slog.DebugContext(q.Context(), "failed to send update", "err", err)
+			failed = true
+			q.disconnect("Disconnected: failed to send an update.")
+		}
+	}
+}
+
+// disconnect ends the session without blocking, if it can be ended.
+func (q *sendQueue) disconnect(message string) {
+	if q.kick == nil {
+		return
+	}
+	select {
+	case q.kick <- message:
+	default: // Already being disconnected
+	}
+}
+
+// close stops queuing updates and waits a while for the queued ones to be
+// written. The writer is left to finish on its own if the client is stuck.
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+	case <-time.After(sendQueueFlushTimeout):
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+)
+
+// stalledStream is a stream whose writes wait to be released one by one.
+type stalledStream struct {
+	*testStream
+
+	writing chan struct{} // Receives when a write starts
+	release chan struct{} // Lets a write finish, or all of them once closed
+}
+
+func (s *stalledStream) Send(update *connect4.GameUpdate) error {
+	select {
+	case s.writing <- struct{}{}:
+		<-s.release
+	case <-s.release:
+	}
+	return s.testStream.Send(update)
+}
+
+func TestSlowPlayerDropsAreCountedInARow(t *testing.T) {
+	s := &server{sendQueueSize: 1, slowPlayerDrops: 3}
+	stream := &stalledStream{testStream: newTestStream(), writing: make(chan struct{}), release: make(chan struct{})}
+	kick := make(chan string, 1)
+	q := s.newSendQueue(stream, kick)
+	defer func() {
+		close(stream.release)
+		q.close()
+	}()
+
+	kicked := func() bool {
+		select {
+		case <-kick:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// The writer is stuck on the first update and the second fills the
+	// queue, so the next two are missed
+	q.Send(&connect4.GameUpdate{})
+	<-stream.writing
+	for i := 0; i < 3; i++ {
+		q.Send(&connect4.GameUpdate{})
+	}
+
+	// The client catches up with one update, which makes room for another
+	stream.release <- struct{}{}
+	<-stream.writing
+	q.Send(&connect4.GameUpdate{})
+
+	// Two more misses make four, but not in a row
+	q.Send(&connect4.GameUpdate{})
+	q.Send(&connect4.GameUpdate{})
+	if kicked() {
+		t.Fatal("the player was disconnected for misses that weren't in a row")
+	}
+
+	q.Send(&connect4.GameUpdate{})
+	if !kicked() {
+		t.Fatal("the player wasn't disconnected after missing 3 updates in a row")
+	}
+}
+
+func TestFlushOutlastsWriteDeadlines(t *testing.T) {
+	for name, deadline := range map[string]time.Duration{"websocket": wsWriteTimeout, "telnet": telnetWriteTimeout} {
+		if sendQueueFlushTimeout <= deadline {
+			t.Errorf("the queue stops flushing after %v, before the %s write deadline of %v", sendQueueFlushTimeout, name, deadline)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errShuttingDown rejects new games while the server drains.
+var errShuttingDown = status.Error(codes.Unavailable, "the server is shutting down and not starting new games, try again later")
+
+// gameCheckpoint is a game in progress saved on shutdown, so its players
+// can finish it once the server is back.
+type gameCheckpoint struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	FirstMove         connect4.GameOptions_FirstMove `json:"first_move"`
+	CreatorMovesFirst bool                           `json:"creator_moves_first"`
+	CreatorSymbol     string                         `json:"creator_symbol"`
+
+	Board         [ROWS][COLS]int32 `json:"board"`
+	Moves         []int32           `json:"moves"`
+	Players       [2]seatCheckpoint `json:"players"`
+	CurrentPlayer int               `json:"current_player"`
+	FirstPlayer   int               `json:"first_player"`
+
+	Wins        [2]int32 `json:"wins"`
+	Ties        int32    `json:"ties"`
+	GamesPlayed int32    `json:"games_played"`
+}
+
+type seatCheckpoint struct {
+	Nickname      string `json:"nickname"`
+	Symbol        string `json:"symbol"`
+	Authenticated bool   `json:"authenticated"`
+}
+
+// checkNewGames returns why no new game can start, if none can.
+func (s *server) checkNewGames() error {
+	s.gamesLock.Lock()
+	defer s.gamesLock.Unlock()
+
+	return s.newGameError()
+}
+
+// newGameError returns why no new game can start, if none can: the server
+// is shutting down or in maintenance. The caller must hold s.gamesLock.
+func (s *server) newGameError() error {
+	switch {
+	case s.draining:
+		return errShuttingDown
+	case s.maintenance && s.maintenanceMessage != "":
+		return status.Error(codes.Unavailable, s.maintenanceMessage)
+	case s.maintenance:
+		return status.Error(codes.Unavailable, "the server is in maintenance and not starting new games, try again later")
+	}
+	return nil
+}
+
+// drain stops the server from starting new games, tells everyone connected
+// and waits up to timeout for the games in progress to finish.
+func (s *server) drain(timeout time.Duration) {
+	s.gamesLock.Lock()
+	s.draining = true
+	games := make([]*game, 0, len(s.games))
+	for _, g := range s.games {
+		games = append(games, g)
+	}
+	s.gamesLock.Unlock()
+
+	for _, g := range games {
+		g.do(func() {
+			message := "The server is shutting down."
+			if g.started && !g.gameOver {
+				message = fmt.Sprintf("The server is shutting down. You have %s to finish the game; if it doesn't end by then and both players are logged in, it will be saved to resume when the server is back.", timeout)
+			}
+			update := &connect4.GameUpdate{Message: message}
+			g.broadcast(update, update)
+			g.watch(update)
+		})
+	}
+
+	deadline := time.Now().Add(timeout)
+	for s.gamesInProgress() > 0 && time.Now().Before(deadline) {
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// gamesInProgress counts the games that started and aren't over.
+func (s *server) gamesInProgress() int {
+	s.gamesLock.Lock()
+	defer s.gamesLock.Unlock()
+
+	count := 0
+	for _, g := range s.games {
+		g.do(func() {
+			if g.started && !g.gameOver {
+				count++
+			}
+		})
+	}
+	return count
+}
+
+// checkpoint saves the games still in progress to path and ends them, so no
+// move made before the connections close is lost. Games with a guest are
+// left out: guests can't take a seat back, so the game could only end in
+// abandonment once restored.
+func (s *server) checkpoint(path string) (int, error) {
+	s.gamesLock.Lock()
+	var checkpoints []gameCheckpoint
+	for _, g := range s.games {
+		g.do(func() {
+			if g.started && !g.gameOver && g.players[0].Authenticated && g.players[1].Authenticated {
+				checkpoints = append(checkpoints, g.checkpoint())
+
+				g.stopAbandonTimer()
+				g.gameOver = true
+				update := &connect4.GameUpdate{Message: "The game was saved. Log in again once the server is back to finish it."}
+				g.broadcast(update, update)
+			}
+		})
+	}
+	s.gamesLock.Unlock()
+
+	if len(checkpoints) == 0 {
+		return 0, nil
+	}
+
+	data, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return 0, err
+	}
+	return len(checkpoints), os.Rename(tmp, path)
+}
+
+// restore brings back the games saved by checkpoint and removes the file.
+// The players have reconnectGrace to come back to them, like after a
+// disconnection.
+func (s *server) restore(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading games checkpoint: %w", err)
+	}
+
+	var checkpoints []gameCheckpoint
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		return 0, fmt.Errorf("parsing games checkpoint: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return 0, err // Restoring the same games on every start would be worse than losing them
+	}
+
+	if s.reconnectGrace <= 0 {
+		slog.Warn("discarding saved games, players can't come back to them without a reconnect grace", "games", len(checkpoints))
+		return 0, nil
+	}
+
+	s.gamesLock.Lock()
+	defer s.gamesLock.Unlock()
+
+	for _, checkpoint := range checkpoints {
+		g := restoreGame(checkpoint)
+		s.games[g.id] = g
+		activeGames.WithLabelValues(metricLabel(g.options.FirstMove.String())).Inc()
+
+		g.do(func() {
+			var timer *time.Timer
+			timer = time.AfterFunc(s.reconnectGrace, func() { s.expireRestoredGame(g, &timer) })
+			g.abandonTimer = timer
+		})
+	}
+	return len(checkpoints), nil
+}
+
+// expireRestoredGame ends a restored game when its players didn't come
+// back in time: the player who came back wins, and a game nobody came back
+// to is discarded.
+func (s *server) expireRestoredGame(g *game, timer **time.Timer) {
+	var empty bool
+	g.do(func() {
+		if g.abandonTimer != *timer {
+			return // Both players came back
+		}
+		g.abandonTimer = nil
+
+		if !g.gameOver {
+			switch {
+			case g.players[0].Stream == nil && g.players[1].Stream == nil:
+				g.gameOver = true
+			case g.players[0].Stream == nil:
+				g.abandon(0)
+			case g.players[1].Stream == nil:
+				g.abandon(1)
+			}
+		}
+
+		empty = g.isEmpty()
+	})
+
+	if empty {
+		s.removeGame(g)
+	}
+}
+
+// checkpoint saves the state of the game. It must run on the game's goroutine.
+func (g *game) checkpoint() gameCheckpoint {
+	checkpoint := gameCheckpoint{
+		ID:                g.id,
+		CreatedAt:         g.createdAt,
+		FirstMove:         g.options.FirstMove,
+		CreatorMovesFirst: g.options.CreatorMovesFirst,
+		CreatorSymbol:     g.options.CreatorSymbol,
+		Board:             g.gameBoard,
+		Moves:             slices.Clone(g.moves),
+		CurrentPlayer:     g.currentPlayer,
+		FirstPlayer:       g.firstPlayer,
+		Wins:              g.wins,
+		Ties:              g.ties,
+		GamesPlayed:       g.gamesPlayed,
+	}
+	for i, player := range g.players {
+		checkpoint.Players[i] = seatCheckpoint{Nickname: player.Nickname, Symbol: player.Symbol, Authenticated: player.Authenticated}
+	}
+	return checkpoint
+}
+
+// restoreGame rebuilds a saved game, with both players disconnected.
+func restoreGame(checkpoint gameCheckpoint) *game {
+	g := &game{
+		id:        checkpoint.ID,
+		createdAt: checkpoint.CreatedAt,
+		options: &connect4.GameOptions{
+			FirstMove:         checkpoint.FirstMove,
+			CreatorMovesFirst: checkpoint.CreatorMovesFirst,
+			CreatorSymbol:     checkpoint.CreatorSymbol,
+		},
+		gameBoard:     checkpoint.Board,
+		moves:         checkpoint.Moves,
+		currentPlayer: checkpoint.CurrentPlayer,
+		firstPlayer:   checkpoint.FirstPlayer,
+		started:       true,
+		wins:          checkpoint.Wins,
+		ties:          checkpoint.Ties,
+		gamesPlayed:   checkpoint.GamesPlayed,
+	}
+	for i, seat := range checkpoint.Players {
+		g.players[i] = &ClientInfo{Nickname: seat.Nickname, Symbol: seat.Symbol, Authenticated: seat.Authenticated}
+	}
+	g.start()
+	return g
+}
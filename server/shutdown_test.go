@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointSkipsGamesWithGuests(t *testing.T) {
+	s := newTestServer(t)
+	path := filepath.Join(t.TempDir(), gamesCheckpointFile)
+
+	// addGame starts a game between two players, logged in or guests
+	addGame := func(authenticated [2]bool) *game {
+		g := newGame(nil)
+		for i, nickname := range []string{"alice", "bob"} {
+			player := &ClientInfo{Nickname: nickname, Authenticated: authenticated[i], Stream: newTestStream()}
+			var err error
+			g.do(func() { _, err = g.seat(player) })
+			if err != nil {
+				t.Fatalf("seating %s: %v", nickname, err)
+			}
+		}
+		s.gamesLock.Lock()
+		s.games[g.id] = g
+		s.gamesLock.Unlock()
+		return g
+	}
+	saved := addGame([2]bool{true, true})
+	addGame([2]bool{true, false})
+	addGame([2]bool{false, false})
+
+	if n, err := s.checkpoint(path); err != nil || n != 1 {
+		t.Fatalf("saved %d games, %v, want only the game between logged in players", n, err)
+	}
+
+	restored := newTestServer(t)
+	if n, err := restored.restore(path); err != nil || n != 1 {
+		t.Fatalf("restored %d games, %v, want 1", n, err)
+	}
+	if _, err := restored.findGame(saved.id); err != nil {
+		t.Errorf("the saved game wasn't restored: %v", err)
+	}
+}
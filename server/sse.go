@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sseEvents are the events of GameUpdate sent to event stream viewers, by
+// their name in the event oneof. Chat is left out.
+var sseEvents = map[string]bool{
+	"game_started": true,
+	"turn_changed": true,
+	"game_over":    true,
+	"announcement": true,
+	"game_closed":  true,
+}
+
+var sseEventField = (&connect4.GameUpdate{}).ProtoReflect().Descriptor().Oneofs().ByName("event")
+
+// serveEvents streams the game with the given ID as Server-Sent Events, for
+// pages that only want to show it. The viewer is added to the game as a
+// spectator, and each update it receives is written as an event named after
+// its type with the GameUpdate as JSON data, e.g.
+//
+//	event: turn_changed
+//	data: {"board": "...", "turn_changed": {"player": "alice", "last_column": 3}}
+//
+// Pages served from other origins must be in allowed to read the stream.
+func (s *server) serveEvents(allowed func(r *http.Request) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowed(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+
+		release, err := s.limits.connect(r.RemoteAddr)
+		if err != nil {
+			http.Error(w, status.Convert(err).Message(), runtime.HTTPStatusFromCode(status.Code(err)))
+			return
+		}
+		defer release()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		// Viewers only watch, so a slow one misses updates and is never
+		// disconnected. The response is done with once the handler returns,
+		// even if the queue's writer still runs
+		events := &sseStream{w: w, rc: http.NewResponseController(w), ctx: r.Context()}
+		defer events.finish()
+		queue := s.newSendQueue(events, nil)
+		queue.setSpectator(true)
+		defer queue.close()
+		var stream connect4.Connect4Game_GameSessionServer = queue
+
+		client := &ClientInfo{IP: r.RemoteAddr, Stream: stream}
+		watched, err := s.spectateGame(r.PathValue("id"), client)
+		if err != nil {
+			http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+			return
+		}
+		defer s.handleDisconnect(watched, stream)
+
+		clients := connectedClients.WithLabelValues(streamTransport(stream))
+		clients.Inc()
+		defer clients.Dec()
+
+		slog.InfoContext(r.Context(), "event stream viewer connected", "game", watched.game.id)
+
+		// Updates are written by the game, the request only has to stay open
+		// until the viewer leaves or the game is removed
+		select {
+		case <-r.Context().Done():
+		case <-watched.game.stopped:
+			stream.Send(gameClosed(watched.game))
+		}
+	}
+}
+
+// sseStream adapts an event stream response to the GameSession stream of a
+// spectator.
+type sseStream struct {
+	grpc.ServerStream // Unused, only Send and Context are called on spectator streams
+
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	ctx context.Context
+
+	writeLock sync.Mutex // Guards finished and writes to the response
+	finished  bool
+}
+
+var _ connect4.Connect4Game_GameSessionServer = (*sseStream)(nil)
+
+func (e *sseStream) Context() context.Context {
+	return e.ctx
+}
+
+func (e *sseStream) Send(update *connect4.GameUpdate) error {
+	field := update.ProtoReflect().WhichOneof(sseEventField)
+	if field == nil || !sseEvents[string(field.Name())] {
+		return nil
+	}
+
+	data, err := wsMarshal.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	e.writeLock.Lock()
+	defer e.writeLock.Unlock()
+
+	if e.finished {
+		return io.ErrClosedPipe
+	}
+	e.rc.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", field.Name(), data); err != nil {
+		return err
+	}
+	return e.rc.Flush()
+}
+
+// finish stops the writes to the response, waiting for the one in progress,
+// as the handler can't write to it once it returned.
+func (e *sseStream) finish() {
+	e.writeLock.Lock()
+	defer e.writeLock.Unlock()
+
+	e.finished = true
+}
+
+func (e *sseStream) Recv() (*connect4.GameCommand, error) {
+	return nil, status.Error(codes.Unimplemented, "event streams are read only")
+}
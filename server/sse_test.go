@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStreamEndsWithGame(t *testing.T) {
+	s := newTestServer(t)
+	client := dialTestServer(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /games/{id}/events", s.serveEvents(func(*http.Request) bool { return true }))
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	gameID, creator := openTestGame(t, ctx, client)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/games/"+gameID+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan string, 1)
+	go func() {
+		defer close(events)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Errorf("reading the events: %v", err)
+		}
+		events <- string(body)
+	}()
+
+	// The headers are only written with the first event, so the game is
+	// polled to know when the viewer watches it
+	s.gamesLock.Lock()
+	g := s.games[gameID]
+	s.gamesLock.Unlock()
+	for watching := false; !watching; time.Sleep(10 * time.Millisecond) {
+		g.do(func() { watching = len(g.spectators) > 0 })
+	}
+	creator.CloseSend()
+
+	body := <-events
+	if !strings.Contains(body, "event: game_closed\n") {
+		t.Errorf("the stream ended without game_closed:\n%s", body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.limits.connectionCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the viewer still counts against the connection limit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	telnetMaxLineLength = 1024
+	telnetWriteTimeout  = 10 * time.Second
+
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+)
+
+const telnetHelp = `Commands:
+  nick <nickname>              play as a guest under nickname
+  login <nickname> <password>  log in to your account (sent in clear text)
+  list                         show the games on the server
+  play [game-id]               join a game, or any game waiting for an opponent
+  create                       open a new game and wait for an opponent
+  watch <game-id>              watch a game
+  1-7                          drop a disc in a column
+  resign, rematch              give up the game, or play again once it is over
+  say <text>, emote <name>     chat with the other players
+  help, quit`
+
+var telnetBoard = strings.NewReplacer("[x]", "["+ansiRed+"x"+ansiReset+"]", "[o]", "["+ansiYellow+"o"+ansiReset+"]")
+
+// serveTelnet accepts plain TCP connections speaking a line protocol meant
+// for telnet and netcat, for players without the Go client.
+func (s *server) serveTelnet(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleTelnet(conn)
+	}
+}
+
+// handleTelnet plays a game session over a telnet connection. Each line
+// typed by the player is translated to a GameCommand and each GameUpdate is
+// rendered as text, with an ANSI colored board.
+func (s *server) handleTelnet(conn net.Conn) {
+	defer conn.Close()
+
+	// The players can't answer pings, so dead connections are found by TCP
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(s.heartbeatInterval)
+	}
+
+	stream := &telnetStream{
+		s:      s,
+		conn:   conn,
+		reader: bufio.NewReaderSize(conn, telnetMaxLineLength),
+		ctx:    context.Background(),
+		limit:  s.limits.newInputLimit(conn.RemoteAddr().String()),
+	}
+
+	release, err := s.limits.connect(conn.RemoteAddr().String())
+	if err != nil {
+		stream.println("Error: " + status.Convert(err).Message())
+		return
+	}
+	defer release()
+
+	stream.println("Welcome to Connect Four! Type help to see the commands.")
+
+	slog.Info("telnet client connected", "ip", conn.RemoteAddr().String())
+
+	// Kicked by an operator or banned for abuse
+	if err := s.handleClientCommands(stream, conn.RemoteAddr().String()); err != nil {
+		stream.println("Error: " + status.Convert(err).Message())
+	}
+}
+
+// telnetStream adapts a telnet connection to the GameSession stream.
+type telnetStream struct {
+	grpc.ServerStream // Unused, only Send, Recv and Context are called on game streams
+
+	s      *server
+	conn   net.Conn
+	reader *bufio.Reader
+	limit  *inputLimit // Shared by the sessions of the connection
+
+	// Replaced on login by the goroutine calling Recv, while the session
+	// and its send queue read the context. Not guarded by writeLock, which
+	// is held while a slow client is written to
+	identityLock sync.Mutex
+	ctx          context.Context
+	nickname     string // Sent with the commands that join a game
+
+	writeLock sync.Mutex // Guards the fields below and writes to the connection
+	spectator bool       // Set when the last game joined was only watched
+}
+
+var _ connect4.Connect4Game_GameSessionServer = (*telnetStream)(nil)
+
+// keepsSession reports whether the session on stream goes on when joining a
+// game fails or the watched game is closed, so the client can pick another
+// one. A command the server rejects, such as joining a full game, ends a
+// gRPC session, but telnet players would have to connect again.
+func keepsSession(stream connect4.Connect4Game_GameSessionServer) bool {
+	_, telnet := stream.(*telnetStream)
+	return telnet
+}
+
+func (t *telnetStream) Context() context.Context {
+	t.identityLock.Lock()
+	defer t.identityLock.Unlock()
+	return t.ctx
+}
+
+// player returns the nickname the connection plays under, empty until one
+// is chosen or logged in to.
+func (t *telnetStream) player() string {
+	t.identityLock.Lock()
+	defer t.identityLock.Unlock()
+	return t.nickname
+}
+
+func (t *telnetStream) inputLimit() *inputLimit {
+	return t.limit
+}
+
+// Send renders an update for the terminal.
+func (t *telnetStream) Send(update *connect4.GameUpdate) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+
+	if welcome := update.GetWelcome(); welcome != nil {
+		t.spectator = welcome.Spectator
+	}
+
+	var text strings.Builder
+	switch event := update.Event.(type) {
+	case *connect4.GameUpdate_Ping:
+		return nil // Telnet clients can't answer, the connection has TCP keepalives instead
+	case *connect4.GameUpdate_Chat:
+		text.WriteString(formatTelnetChat(event.Chat))
+	case *connect4.GameUpdate_ChatHistory:
+		for _, message := range event.ChatHistory.Messages {
+			text.WriteString(formatTelnetChat(message) + "\n")
+		}
+	case *connect4.GameUpdate_Lobby:
+		text.WriteString(formatTelnetLobby(event.Lobby))
+	default:
+		if update.Message != "" {
+			text.WriteString(telnetText(update.Message, true) + "\n")
+		}
+		if update.Board != "" {
+			text.WriteString(" 1  2  3  4  5  6  7\n" + telnetBoard.Replace(update.Board))
+		}
+		switch {
+		case update.GetTurnChanged().GetYourTurn():
+			text.WriteString("Your move (1-7):")
+		case update.GetGameOver() != nil && !t.spectator:
+			text.WriteString("Type rematch to play again or quit to leave.")
+		}
+	}
+	return t.write(strings.TrimRight(text.String(), "\n"))
+}
+
+// Recv reads lines until one is a game command. The commands that only
+// concern the connection, like nick and login, are handled here.
+func (t *telnetStream) Recv() (*connect4.GameCommand, error) {
+	for {
+		line, err := t.reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = t.reader.ReadSlice('\n') // Skip the rest of the line
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := t.limit.reject(t.Context(), "message_too_large"); err != nil {
+				return nil, err
+			}
+			t.println("Line too long.")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		text := strings.Trim(stripTelnetCommands(string(line)), " \t\r\n\x00")
+		name, arg, _ := strings.Cut(text, " ")
+		name, arg = strings.ToLower(name), strings.TrimSpace(arg)
+		if column, err := strconv.Atoi(name); err == nil {
+			return &connect4.GameCommand{Command: "move", Column: int32(column - 1)}, nil
+		}
+		ok, err := t.limitLine(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case "":
+		case "help", "?":
+			t.println(telnetHelp)
+		case "quit", "exit":
+			t.println("Bye!")
+			return nil, io.EOF
+		case "nick":
+			nickname, err := cleanNickname(arg)
+			if err != nil {
+				t.println(err.Error())
+				continue
+			}
+			t.identityLock.Lock()
+			t.nickname = nickname
+			t.identityLock.Unlock()
+			t.println("You will play as " + nickname + ".")
+		case "login":
+			t.login(arg)
+		case "list":
+			return &connect4.GameCommand{Command: "list"}, nil
+		case "play", "create", "watch":
+			nickname := t.player()
+			if nickname == "" {
+				t.println("Choose a nickname first with nick <nickname>, or log in.")
+				continue
+			}
+
+			command := &connect4.GameCommand{Command: "join", GameId: arg, Nickname: nickname}
+			switch name {
+			case "create":
+				command.Command = "create"
+			case "watch":
+				command.Command = "spectate"
+			}
+			return command, nil
+		case "resign", "rematch":
+			return &connect4.GameCommand{Command: name}, nil
+		case "say":
+			return &connect4.GameCommand{Command: "chat", Text: arg}, nil
+		case "emote":
+			return &connect4.GameCommand{Command: "emote", Text: arg}, nil
+		default:
+			t.println("Unknown command " + name + ". Type help to see the commands.")
+		}
+	}
+}
+
+// limitLine checks a line that is handled here instead of becoming a
+// command against the limits of the session, reporting whether it can be
+// handled. Logins are limited on their own, as each one costs a bcrypt
+// comparison, and unknown lines are violations.
+func (t *telnetStream) limitLine(name string) (bool, error) {
+	kind := "command_rate"
+	switch name {
+	case "list", "resign", "rematch", "say", "emote", "quit", "exit":
+		return true, nil // Limited by the session, if it becomes a command
+	case "play", "create", "watch":
+		if t.player() != "" {
+			return true, nil
+		}
+	case "", "help", "?", "nick":
+	case "login":
+		kind = "login_rate"
+	default:
+		return true, t.limit.reject(t.Context(), "unknown_command")
+	}
+
+	ok, err := t.limit.allow(t.Context(), kind)
+	if !ok && err == nil {
+		t.println("You are sending commands too fast. Slow down!")
+	}
+	return ok, err
+}
+
+// login authenticates the connection with the account's password, so the
+// following games are played under the account's nickname.
+func (t *telnetStream) login(arg string) {
+	nickname, password, _ := strings.Cut(arg, " ")
+	nickname, err := t.s.accounts.Authenticate(nickname, strings.TrimSpace(password))
+	if err != nil {
+		t.println("Login failed: " + err.Error() + ".")
+		return
+	}
+	if err := t.s.bans.Check(nickname); err != nil {
+		t.println("Login failed: " + status.Convert(err).Message() + ".")
+		return
+	}
+
+	t.identityLock.Lock()
+	t.ctx = withPlayer(t.ctx, nickname)
+	t.nickname = nickname
+	t.identityLock.Unlock()
+	t.println("Logged in as " + telnetText(nickname, false) + ".")
+}
+
+// println writes a line to the player.
+func (t *telnetStream) println(text string) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+
+	return t.write(text)
+}
+
+// write writes a line, with the CRLF line endings telnet expects. The
+// caller must hold t.writeLock.
+func (t *telnetStream) write(text string) error {
+	t.conn.SetWriteDeadline(time.Now().Add(telnetWriteTimeout))
+	_, err := io.WriteString(t.conn, strings.ReplaceAll(text, "\n", "\r\n")+"\r\n")
+	return err
+}
+
+// stripTelnetCommands removes the option negotiation a telnet client may
+// send (IAC sequences) from a line.
+func stripTelnetCommands(line string) string {
+	const iac = 255
+	if strings.IndexByte(line, iac) < 0 {
+		return line
+	}
+
+	var clean strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] != iac {
+			clean.WriteByte(line[i])
+			continue
+		}
+		// IAC is followed by a command, and WILL, WONT, DO and DONT by an option
+		if i+1 < len(line) && line[i+1] >= 251 && line[i+1] <= 254 {
+			i++
+		}
+		i++
+	}
+	return clean.String()
+}
+
+// telnetText removes the C0 and C1 control characters from text written to
+// a terminal, as the chat, nicknames and messages written by players and
+// operators could otherwise move the cursor, clear the screen or fake lines
+// from the server. Line breaks are only kept in multiline text.
+func telnetText(text string, multiline bool) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' && multiline:
+			return r
+		case r == '\t':
+			return ' '
+		case r < 0x20, r >= 0x7f && r <= 0x9f:
+			return -1
+		}
+		return r
+	}, text)
+}
+
+func formatTelnetChat(message *connect4.ChatMessage) string {
+	prefix := ""
+	if message.Channel == connect4.ChatMessage_SPECTATORS {
+		prefix = "[spectators] "
+	}
+	return prefix + "<" + telnetText(message.From, false) + "> " + telnetText(message.Text, false)
+}
+
+func formatTelnetLobby(lobby *connect4.Lobby) string {
+	if len(lobby.Games) == 0 {
+		return "No games yet. Type create to open one."
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%-10s %-30s %-10s %s\n", "GAME", "PLAYERS", "STATUS", "SPECTATORS")
+	for _, game := range lobby.Games {
+		state := "playing"
+		switch {
+		case game.GameOver:
+			state = "over"
+		case game.WaitingForOpponent:
+			state = "waiting"
+		}
+		fmt.Fprintf(&text, "%-10s %-30s %-10s %d\n", game.GameId, telnetText(strings.Join(game.Players, " vs "), false), state, game.Spectators)
+	}
+	return text.String()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+)
+
+func TestTelnetSpectatorOutlivesRemovedGame(t *testing.T) {
+	s := newTestServer(t)
+	client := dialTestServer(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	gameID, creator := openTestGame(t, ctx, client)
+
+	server, conn := net.Pipe()
+	go s.handleTelnet(server)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	lines := bufio.NewScanner(conn)
+
+	// readUntil reads the lines of the server until one contains text
+	readUntil := func(text string) {
+		t.Helper()
+		for lines.Scan() {
+			if strings.Contains(lines.Text(), text) {
+				return
+			}
+		}
+		t.Fatalf("the server never wrote %q: %v", text, lines.Err())
+	}
+	send := func(line string) {
+		t.Helper()
+		if _, err := conn.Write([]byte(line + "\r\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readUntil("Welcome")
+	send("nick bob")
+	readUntil("You will play as bob")
+	send("watch " + gameID)
+	readUntil("You are watching game " + gameID)
+
+	creator.CloseSend()
+	readUntil("Game " + gameID + " was closed")
+
+	// The connection is still there to pick another game
+	send("watch " + gameID)
+	readUntil("Error: game " + gameID + " not found")
+	send("create")
+	readUntil("Welcome to Connect Four, bob!")
+}
+
+func TestTelnetTextStripsControlCharacters(t *testing.T) {
+	tests := []struct {
+		text      string
+		multiline bool
+		want      string
+	}{
+		{"hello", false, "hello"},
+		{"\x1b[2J\x1b[Hgotcha", false, "[2J[Hgotcha"},
+		{"bell\a and backspace\b", false, "bell and backspace"},
+		{"fake\r\nline", false, "fakeline"},
+		{"two\nlines", true, "two\nlines"},
+		{"tab\there", false, "tab here"},
+		{"c1\u009bcontrol\u0085", false, "c1control"},
+		{"del\x7f", false, "del"},
+		{"olá, 世界", false, "olá, 世界"},
+	}
+	for _, test := range tests {
+		if got := telnetText(test.text, test.multiline); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestTelnetChatIsSanitized(t *testing.T) {
+	message := &connect4.ChatMessage{From: "eve\x1b[31m", Text: "hi\r\n<alice> give me your password"}
+	if got, want := formatTelnetChat(message), "<eve[31m> hi<alice> give me your password"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
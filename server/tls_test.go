@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// writeTestCerts writes a CA, a certificate for a server on localhost and a
+// client certificate for each of the common names to a temporary directory,
+// laid out like gencerts does, and returns the directory.
+func writeTestCerts(t *testing.T, clients map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Connect Four test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caKey := issueTestCert(t, dir, "ca", ca, nil, nil)
+
+	server := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	issueTestCert(t, dir, "server", server, ca, caKey)
+
+	serial := int64(3)
+	for name, commonName := range clients {
+		client := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: commonName},
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		issueTestCert(t, dir, "client-"+name, client, ca, caKey)
+		serial++
+	}
+	return dir
+}
+
+// issueTestCert signs template with the parent, or with itself when parent
+// is nil, and writes <name>.pem and <name>-key.pem to dir.
+func issueTestCert(t *testing.T, dir, name string, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*pem.Block{
+		name + ".pem":     {Type: "CERTIFICATE", Bytes: der},
+		name + "-key.pem": {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for file, block := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return key
+}
+
+// serveTLSTestServer serves s over TLS on a loopback address with the
+// certificates in dir, verifying client certificates against the CA when
+// clientCA is set, and returns the address.
+func serveTLSTestServer(t *testing.T, s *server, dir string, clientCA, requireClientCert bool) string {
+	t.Helper()
+	caFile := ""
+	if clientCA {
+		caFile = filepath.Join(dir, "ca.pem")
+	}
+	tlsConfig, err := serverTLSConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"), caFile, requireClientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.ChainUnaryInterceptor(s.unaryAuthInterceptor),
+		grpc.ChainStreamInterceptor(s.streamAuthInterceptor),
+	)
+	connect4.RegisterConnect4GameServer(grpcServer, s)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	return lis.Addr().String()
+}
+
+// dialTLSTestServer returns a client of the server at addr that trusts the
+// CA in dir and presents the certificate client-<client>.pem, unless client
+// is empty.
+func dialTLSTestServer(t *testing.T, addr, dir, client string) connect4.Connect4GameClient {
+	t.Helper()
+	pool, err := loadCertPool(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig := &tls.Config{RootCAs: pool, ServerName: "localhost", MinVersion: tls.VersionTLS12}
+	if client != "" {
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client-"+client+".pem"), filepath.Join(dir, "client-"+client+"-key.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return connect4.NewConnect4GameClient(conn)
+}
+
+// joinedAs opens a game as a guest named guest and returns the nickname the
+// server seated the player under.
+func joinedAs(t *testing.T, ctx context.Context, client connect4.Connect4GameClient) string {
+	t.Helper()
+	stream, err := client.GameSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.CloseSend()
+	stream.Send(&connect4.GameCommand{Command: "create", Nickname: "guest"})
+	update, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("opening a game: %v", err)
+	}
+	return update.GetWelcome().GetNickname()
+}
+
+func TestTLS(t *testing.T) {
+	dir := writeTestCerts(t, nil)
+	addr := serveTLSTestServer(t, newTestServer(t), dir, false, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := dialTLSTestServer(t, addr, dir, "").ListGames(ctx, &connect4.ListGamesRequest{}); err != nil {
+		t.Fatalf("calling the server over TLS: %v", err)
+	}
+
+	// The certificate of the server is only trusted through the test CA
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{ServerName: "localhost"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := connect4.NewConnect4GameClient(conn).ListGames(ctx, &connect4.ListGamesRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("calling the server without trusting its CA: got %v, want %v", err, codes.Unavailable)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := writeTestCerts(t, map[string]string{"alice": "alice", "spaced": " bob ", "invisible": "alice\u200b"})
+	addr := serveTLSTestServer(t, newTestServer(t), dir, true, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The common name of the certificate is the player, whatever nickname
+	// is sent
+	if nickname := joinedAs(t, ctx, dialTLSTestServer(t, addr, dir, "alice")); nickname != "alice" {
+		t.Errorf("the player with alice's certificate joined as %q", nickname)
+	}
+	if nickname := joinedAs(t, ctx, dialTLSTestServer(t, addr, dir, "spaced")); nickname != "bob" {
+		t.Errorf("the player with bob's certificate joined as %q", nickname)
+	}
+
+	// Client certificates are optional, so players without one are guests
+	if nickname := joinedAs(t, ctx, dialTLSTestServer(t, addr, dir, "")); nickname != "guest" {
+		t.Errorf("the player without a certificate joined as %q, want the guest nickname", nickname)
+	}
+
+	_, err := dialTLSTestServer(t, addr, dir, "invisible").ListGames(ctx, &connect4.ListGamesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("calling with a certificate named %q: got %v, want %v", "alice\u200b", err, codes.Unauthenticated)
+	}
+}
+
+func TestMutualTLSRequired(t *testing.T) {
+	dir := writeTestCerts(t, map[string]string{"alice": "alice"})
+	addr := serveTLSTestServer(t, newTestServer(t), dir, true, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := dialTLSTestServer(t, addr, dir, "alice").ListGames(ctx, &connect4.ListGamesRequest{}); err != nil {
+		t.Fatalf("calling with a client certificate: %v", err)
+	}
+	if _, err := dialTLSTestServer(t, addr, dir, "").ListGames(ctx, &connect4.ListGamesRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("calling without a client certificate: got %v, want %v", err, codes.Unavailable)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the game logic. The spans of the RPCs
+// themselves come from the otelgrpc stats handler.
+var tracer = otel.Tracer("github.com/danieljcksn/connect-four/server")
+
+// setupTracing installs the tracer provider for the configured exporter,
+// and the W3C trace context propagator, so clients can put the RPCs in their
+// own traces. The returned function flushes the spans not yet exported.
+func setupTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		var opts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("connect4-server")))
+	if err != nil {
+		return nil, err
+	}
+
+	// The sampler can be chosen with the standard OTEL_TRACES_SAMPLER
+	// variables, and follows the client's decision by default
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startCommandSpan starts the span of a command received on a game session.
+func startCommandSpan(ctx context.Context, command *connect4.GameCommand, current *session) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("connect4.command", command.Command)}
+	switch command.Command {
+	case "move":
+		attrs = append(attrs, attribute.Int("connect4.column", int(command.Column)))
+	case "join", "spectate":
+		attrs = append(attrs, attribute.String("connect4.requested_game_id", command.GameId))
+	}
+	if current != nil {
+		attrs = append(attrs, attribute.String("connect4.game_id", current.game.id), attribute.String("connect4.nickname", current.client.Nickname))
+	}
+
+	return tracer.Start(ctx, "connect4.command "+command.Command, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, recording err if the operation failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
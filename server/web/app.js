@@ -0,0 +1,358 @@
+// Browser client of the Connect Four server. It plays through the WebSocket
+// gateway, which exchanges GameCommand and GameUpdate messages as JSON.
+"use strict";
+
+const COLS = 7;
+const ROWS = 6;
+const LOBBY_REFRESH = 3000; // Milliseconds between lobby updates
+const PING_INTERVAL = 15000; // Milliseconds between the pings measuring the latency
+
+const $ = (id) => document.getElementById(id);
+
+// The session token of a logged in player can be given as ?token=...
+const token = new URLSearchParams(location.search).get("token");
+
+let socket = null;
+let lobbyTimer = null;
+let pingTimer = null;
+let state = newState();
+
+function newState() {
+  return { inGame: false, spectator: false, symbol: "", myTurn: false, over: false, players: [], board: emptyBoard() };
+}
+
+function emptyBoard() {
+  return Array.from({ length: ROWS }, () => Array(COLS).fill(" "));
+}
+
+// connect opens a new WebSocket session. Each session plays a single game,
+// so going back to the lobby opens a new one.
+function connect() {
+  const scheme = location.protocol === "https:" ? "wss" : "ws";
+  const query = token ? "?token=" + encodeURIComponent(token) : "";
+  socket = new WebSocket(`${scheme}://${location.host}/ws${query}`);
+
+  socket.onopen = () => {
+    $("connection").textContent = connectionText();
+    refreshLobby();
+    lobbyTimer = setInterval(refreshLobby, LOBBY_REFRESH);
+    sendPing();
+    pingTimer = setInterval(sendPing, PING_INTERVAL);
+  };
+
+  socket.onmessage = (event) => handleUpdate(JSON.parse(event.data));
+
+  socket.onclose = (event) => {
+    clearInterval(lobbyTimer);
+    clearInterval(pingTimer);
+    $("connection").textContent = "Disconnected";
+    if (event.reason) {
+      addMessage(event.reason, "event");
+      alert(event.reason);
+    }
+    if (state.inGame) {
+      setStatus("Disconnected from the server.");
+      setPlayable(false);
+    } else {
+      setTimeout(connect, 2000);
+    }
+  };
+}
+
+function send(command) {
+  if (socket && socket.readyState === WebSocket.OPEN) {
+    socket.send(JSON.stringify(command));
+  }
+}
+
+function connectionText(latency) {
+  const text = token ? "Connected (logged in)" : "Connected";
+  return latency === undefined ? text : `${text} · ${latency} ms`;
+}
+
+// sendPing asks the server for a pong, which tells the latency. The
+// timestamps are in microseconds, like the ones of the server.
+function sendPing() {
+  send({ command: "ping", sent_at: Date.now() * 1000 });
+}
+
+function refreshLobby() {
+  if (!state.inGame) {
+    send({ command: "list" });
+  }
+}
+
+function handleUpdate(update) {
+  // The server ends the sessions that stop answering its pings
+  if (update.ping) {
+    send({ command: "pong", sent_at: update.ping.sent_at });
+    return;
+  }
+  if (update.pong) {
+    const latency = Math.max(Math.round(Date.now() - Number(update.pong.sent_at) / 1000), 0);
+    $("connection").textContent = connectionText(latency);
+    return;
+  }
+
+  if (update.board) {
+    state.board = parseBoard(update.board);
+    drawBoard();
+  }
+
+  if (update.lobby) {
+    drawLobby(update.lobby.games || []);
+    return;
+  }
+
+  if (update.chat) {
+    addChat(update.chat);
+    return;
+  }
+  if (update.chat_history) {
+    (update.chat_history.messages || []).forEach(addChat);
+    return;
+  }
+
+  if (update.message) {
+    addMessage(update.message, "event");
+  }
+
+  if (update.welcome) {
+    state.inGame = true;
+    state.spectator = !!update.welcome.spectator;
+    state.symbol = update.welcome.symbol || "";
+    showGame(update.welcome.game_id);
+    setStatus(update.message);
+  } else if (update.game_started) {
+    const started = update.game_started;
+    state.players = started.players || [];
+    state.over = false;
+    state.board = emptyBoard();
+    drawBoard();
+    $("title").textContent = describePlayers(started.series);
+    $("rematch").hidden = true;
+    $("resign").hidden = state.spectator;
+  } else if (update.turn_changed) {
+    state.myTurn = !!update.turn_changed.your_turn;
+    setStatus(state.myTurn ? "Your turn! Click a column." : `${update.turn_changed.player}'s turn.`);
+  } else if (update.move_rejected) {
+    // The server still waits for a move after an invalid column
+    state.myTurn = update.move_rejected.reason === "INVALID_COLUMN";
+    setStatus(update.message);
+  } else if (update.game_over) {
+    state.myTurn = false;
+    state.over = true;
+    setStatus(update.message || describeResult(update.game_over));
+    $("title").textContent = describePlayers(update.game_over.series);
+    $("rematch").hidden = state.spectator;
+    $("rematch").textContent = "Rematch";
+    $("resign").hidden = true;
+  } else if (update.game_closed) {
+    // The server ends the session of spectators, so the page reconnects
+    state.inGame = false;
+    setStatus(update.message);
+  } else if (update.rematch_offered) {
+    $("rematch").textContent = "Accept rematch";
+    setStatus(`${update.rematch_offered.from} wants a rematch!`);
+  }
+
+  setPlayable(state.myTurn);
+}
+
+function describePlayers(series) {
+  const players = (series && series.players) || state.players;
+  if (players.length < 2) {
+    return "";
+  }
+  const [a, b] = players;
+  let title = `${a.nickname} (${a.symbol}) vs ${b.nickname} (${b.symbol})`;
+  if (series && series.games_played) {
+    title += ` — ${a.wins || 0} : ${b.wins || 0}`;
+    if (series.ties) {
+      title += `, ${series.ties} tie(s)`;
+    }
+  }
+  return title;
+}
+
+function describeResult(over) {
+  if (!over.winner) {
+    return "The game is a tie.";
+  }
+  return over.you_won ? "You won!" : `${over.winner} won the game.`;
+}
+
+// parseBoard splits a board formatted as "[x][o][ ]" rows into its cells.
+function parseBoard(board) {
+  return board.trim().split("\n").map((line) => line.slice(1, -1).split("]["));
+}
+
+function drawBoard() {
+  const board = $("board");
+  board.replaceChildren();
+  for (let row = 0; row < ROWS; row++) {
+    for (let col = 0; col < COLS; col++) {
+      const cell = document.createElement("div");
+      const symbol = state.board[row] ? state.board[row][col] : " ";
+      cell.className = "cell" + (symbol === "x" || symbol === "o" ? " " + symbol : "");
+      cell.dataset.col = col;
+      board.appendChild(cell);
+    }
+  }
+}
+
+function setPlayable(playable) {
+  $("board").classList.toggle("playable", playable);
+}
+
+function drawLobby(games) {
+  const body = $("games");
+  body.replaceChildren();
+  if (games.length === 0) {
+    body.innerHTML = '<tr><td colspan="5">No games yet.</td></tr>';
+    return;
+  }
+
+  for (const game of games) {
+    const row = document.createElement("tr");
+    const status = game.waiting_for_opponent ? "Waiting for an opponent" : game.game_over ? "Over" : "Playing";
+    for (const text of [game.game_id, (game.players || []).join(" vs "), status, game.spectators || 0]) {
+      const cell = document.createElement("td");
+      cell.textContent = text;
+      row.appendChild(cell);
+    }
+
+    const actions = document.createElement("td");
+    if (game.waiting_for_opponent) {
+      actions.appendChild(button("Join", () => start({ command: "join", game_id: game.game_id })));
+    }
+    actions.appendChild(button("Watch", () => start({ command: "spectate", game_id: game.game_id })));
+    row.appendChild(actions);
+    body.appendChild(row);
+  }
+}
+
+function button(label, onClick) {
+  const b = document.createElement("button");
+  b.textContent = label;
+  b.onclick = onClick;
+  return b;
+}
+
+// start sends a command that seats the player, or makes it watch a game.
+function start(command) {
+  const nickname = $("nickname").value.trim();
+  if (!nickname && !token) {
+    $("nickname").focus();
+    $("nickname").reportValidity();
+    return;
+  }
+  localStorage.setItem("nickname", nickname);
+  send({ ...command, nickname });
+}
+
+function gameOptions() {
+  switch ($("first-move").value) {
+    case "CREATOR_FIRST":
+      return { first_move: "CREATOR", creator_moves_first: true };
+    case "CREATOR_SECOND":
+      return { first_move: "CREATOR", creator_moves_first: false };
+    default:
+      return { first_move: $("first-move").value };
+  }
+}
+
+function showGame(gameID) {
+  $("lobby").hidden = true;
+  $("game").hidden = false;
+  $("messages").replaceChildren();
+  $("title").textContent = state.spectator ? `Watching game ${gameID}` : `Game ${gameID}`;
+  $("resign").hidden = true;
+  $("rematch").hidden = true;
+  drawBoard();
+}
+
+function showLobby() {
+  state = newState();
+  $("game").hidden = true;
+  $("lobby").hidden = false;
+  if (socket) {
+    socket.onclose = null;
+    socket.close();
+  }
+  connect();
+}
+
+function setStatus(text) {
+  if (text) {
+    $("status").textContent = text;
+  }
+}
+
+function addChat(message) {
+  const text = message.emote ? `* ${message.from} ${message.text}` : `<${message.from}> ${message.text}`;
+  addMessage(text, message.channel === "SPECTATORS" ? "spectators" : "chat");
+}
+
+function addMessage(text, kind) {
+  const item = document.createElement("li");
+  item.className = kind;
+  item.textContent = text;
+  const messages = $("messages");
+  messages.appendChild(item);
+  messages.scrollTop = messages.scrollHeight;
+}
+
+$("start").onsubmit = (event) => {
+  event.preventDefault();
+  if (event.submitter && event.submitter.name === "create") {
+    start({ command: "create", options: gameOptions() });
+  } else {
+    start({ command: "connect" });
+  }
+};
+
+$("board").onclick = (event) => {
+  const col = event.target.dataset.col;
+  if (col === undefined || !state.myTurn) {
+    return;
+  }
+  state.myTurn = false; // Wait for the server to accept the move
+  setPlayable(false);
+  send({ command: "move", column: Number(col) });
+};
+
+$("board").onmouseover = (event) => {
+  const col = event.target.dataset.col;
+  for (const cell of $("board").children) {
+    cell.classList.toggle("hover", col !== undefined && cell.dataset.col === col);
+  }
+};
+
+$("say").onsubmit = (event) => {
+  event.preventDefault();
+  const text = $("text").value.trim();
+  if (text) {
+    send({ command: "chat", text });
+    $("text").value = "";
+  }
+};
+
+$("emotes").onclick = (event) => {
+  if (event.target.dataset.emote) {
+    send({ command: "emote", text: event.target.dataset.emote });
+  }
+};
+
+$("resign").onclick = () => {
+  if (confirm("Resign this game?")) {
+    send({ command: "resign" });
+  }
+};
+
+$("rematch").onclick = () => send({ command: "rematch" });
+$("leave").onclick = showLobby;
+
+$("nickname").value = localStorage.getItem("nickname") || "";
+drawBoard();
+connect();
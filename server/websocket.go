@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	connect4 "github.com/danieljcksn/connect-four/proto"
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const wsWriteTimeout = 10 * time.Second // Time allowed to write an update to a slow client
+
+var (
+	wsMarshal   = protojson.MarshalOptions{UseProtoNames: true}
+	wsUnmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// serveWebSocket plays a game session over a WebSocket connection. The
+// client sends GameCommand messages and receives GameUpdate messages, both
+// as JSON text frames in the protobuf JSON mapping, e.g.
+//
+//	{"command": "connect", "nickname": "alice"}
+//	{"command": "move", "column": 3}
+//
+// Browsers can't set headers on WebSocket requests, so the session token may
+// also be given in the token query parameter.
+func (s *server) serveWebSocket(upgrader *websocket.Upgrader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := s.authenticate(grpcContext(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		release, err := s.limits.connect(r.RemoteAddr)
+		if err != nil {
+			http.Error(w, status.Convert(err).Message(), runtime.HTTPStatusFromCode(status.Code(err)))
+			return
+		}
+		defer release()
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return // The upgrader already replied with an error
+		}
+		defer conn.Close()
+		conn.SetReadLimit(int64(s.limits.cfg.MaxMessageSize))
+
+		stream := &wsStream{conn: conn, ctx: ctx, limit: s.limits.newInputLimit(r.RemoteAddr)}
+		if err := s.handleClientCommands(stream, r.RemoteAddr); err != nil {
+			stream.closeWithError(err)
+			return
+		}
+		stream.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}
+}
+
+// grpcContext describes an HTTP request the way gRPC describes a call, so
+// the same authentication applies to both: the Authorization header (or
+// the token query parameter) becomes the authorization metadata, and the
+// TLS state the peer information.
+func grpcContext(r *http.Request) context.Context {
+	ctx := r.Context()
+
+	authorization := r.Header.Get("Authorization")
+	if token := r.URL.Query().Get("token"); authorization == "" && token != "" {
+		authorization = "Bearer " + token
+	}
+	if authorization != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization))
+	}
+
+	p := &peer.Peer{Addr: remoteAddr(r.RemoteAddr)}
+	if r.TLS != nil {
+		p.AuthInfo = credentials.TLSInfo{State: *r.TLS}
+	}
+	return peer.NewContext(ctx, p)
+}
+
+func remoteAddr(addr string) net.Addr {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return tcpAddr
+}
+
+// checkOrigin accepts requests from the server's own origin, from origins in
+// allowed ("*" allows any) and from clients that aren't browsers, which
+// don't send an Origin header.
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || slices.Contains(allowed, "*") || slices.Contains(allowed, origin) {
+			return true
+		}
+
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+}
+
+// wsStream adapts a WebSocket connection to the GameSession stream, so
+// WebSocket clients play through the same code as gRPC clients.
+type wsStream struct {
+	grpc.ServerStream // Unused, only Send, Recv and Context are called on game streams
+
+	conn  *websocket.Conn
+	ctx   context.Context
+	limit *inputLimit // Counts the messages that aren't commands
+
+	writeLock sync.Mutex // The connection supports a single concurrent writer
+}
+
+var _ connect4.Connect4Game_GameSessionServer = (*wsStream)(nil)
+
+func (w *wsStream) Context() context.Context {
+	return w.ctx
+}
+
+func (w *wsStream) inputLimit() *inputLimit {
+	return w.limit
+}
+
+func (w *wsStream) Send(update *connect4.GameUpdate) error {
+	data, err := wsMarshal.Marshal(update)
+	if err != nil {
+		return err
+	}
+	return w.write(websocket.TextMessage, data)
+}
+
+// Recv reads the next command. Messages that aren't valid commands are
+// protocol violations, answered with an error message and skipped.
+func (w *wsStream) Recv() (*connect4.GameCommand, error) {
+	for {
+		_, data, err := w.conn.ReadMessage()
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			return nil, io.EOF // Like a gRPC client closing the stream
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		command := &connect4.GameCommand{}
+		if err := wsUnmarshal.Unmarshal(data, command); err != nil {
+			slog.DebugContext(w.ctx, "invalid websocket command", "err", err)
+			if err := w.limit.reject(w.ctx, "bad_frame"); err != nil {
+				return nil, err
+			}
+			w.Send(&connect4.GameUpdate{Message: "Invalid command: " + err.Error()})
+			continue
+		}
+		return command, nil
+	}
+}
+
+func (w *wsStream) write(messageType int, data []byte) error {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	w.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return w.conn.WriteMessage(messageType, data)
+}
+
+// closeWithError closes the connection telling the client why the session
+// ended, like the status of a failed gRPC call.
+func (w *wsStream) closeWithError(err error) {
+	st := status.Convert(err)
+	reason := st.Code().String() + ": " + st.Message()
+	if len(reason) > 120 {
+		reason = reason[:120] // Close frames are limited to 125 bytes
+	}
+	w.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+}